@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MasFana/fana-envy/internal/diff"
+	"github.com/MasFana/fana-envy/internal/utils"
+)
+
+var diffUsage = "envy " + diff.Usage + " [--json]"
+
+// diffCommand compares two profiles, .env files or the host environment.
+// Like diff(1) it exits with 0 when they match, 1 when they differ and 2 on
+// errors.
+func diffCommand(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	var opts diff.Options
+	fs.BoolVar(&opts.KeysOnly, "keys-only", false, "list differing keys without values")
+	fs.BoolVar(&opts.Reveal, "reveal", false, "print secret values instead of masking them")
+	asJSON := fs.Bool("json", false, "print machine readable JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: "+diffUsage)
+		fs.PrintDefaults()
+	}
+	args, err := utils.ParseFlags(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(args) != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	envDir := envDirPath()
+	dir, _ := os.Getwd()
+	var sides [2]*diff.Side
+	for i, spec := range args {
+		if sides[i], err = diff.Load(envDir, dir, spec); err != nil {
+			fmt.Fprintf(os.Stderr, "envy diff: %v\n", err)
+			return 2
+		}
+	}
+	a, b := sides[0], sides[1]
+
+	opts.Patterns = secretPatterns(envDir)
+	res := diff.Compare(a, b)
+
+	if *asJSON {
+		printJSON(res)
+	} else {
+		for _, l := range res.Lines(a, b, opts) {
+			fmt.Printf("%c %s\n", l.Op, l.Text)
+		}
+		fmt.Println(res.Summary(a, b))
+	}
+	if res.Empty() {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MasFana/fana-envy/internal/exporter"
+	"github.com/MasFana/fana-envy/internal/profile"
+	"github.com/MasFana/fana-envy/internal/utils"
+)
+
+const exportUsage = "envy export [-f format] [profile]"
+
+// exportCommand prints a profile's resolved variables in a shell or tool
+// specific format, e.g. for `eval "$(envy export -f bash staging)"`.
+func exportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	var format string
+	fs.StringVar(&format, "f", "bash", "output format")
+	fs.StringVar(&format, "format", "bash", "output format")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: "+exportUsage)
+		fmt.Fprintln(os.Stderr, "Formats:", exporter.Formats)
+		fs.PrintDefaults()
+	}
+	args, err := utils.ParseFlags(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(args) > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	envDir := envDirPath()
+	name := activeProfile(envDir)
+	if len(args) == 1 {
+		name = args[0]
+	}
+	if !profile.Exists(envDir, name) {
+		fmt.Fprintf(os.Stderr, "envy export: %v: %s\n", profile.ErrNotFound, name)
+		return 1
+	}
+
+	env := profile.Resolve(envDir, name, os.LookupEnv)
+	for _, err := range env.Errors {
+		fmt.Fprintf(os.Stderr, "envy: %v\n", err)
+	}
+
+	out, err := exporter.Export(env.Vars, format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "envy export: %v\n", err)
+		return 1
+	}
+	fmt.Print(out)
+	return 0
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/MasFana/fana-envy/internal/diff"
+	"github.com/MasFana/fana-envy/internal/profile"
+	"github.com/MasFana/fana-envy/internal/utils"
+)
+
+var historyUsage = "envy " + profile.HistoryUsage + " [--reveal] [--json]"
+
+// historyCommand lists, compares and restores saved revisions of a
+// profile. `undo` restores the revision before the last write.
+func historyCommand(name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print machine readable JSON")
+	reveal := fs.Bool("reveal", false, "print secret values in history diff")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: "+historyUsage)
+		fs.PrintDefaults()
+	}
+	args, err := utils.ParseFlags(fs, args)
+	if err != nil {
+		return 2
+	}
+
+	envDir := envDirPath()
+	if name == "undo" {
+		if len(args) > 1 {
+			fs.Usage()
+			return 2
+		}
+		prof := activeProfile(envDir)
+		if len(args) == 1 {
+			prof = args[0]
+		}
+		n, err := profile.Undo(envDir, prof)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "envy undo: %v\n", err)
+			return 1
+		}
+		report(*asJSON, "undo", map[string]any{"profile": prof, "revision": n},
+			fmt.Sprintf("✓ Restored %s to revision %d", prof, n))
+		return 0
+	}
+	sub := "list"
+	if len(args) > 0 && (args[0] == "list" || args[0] == "diff" || args[0] == "restore") {
+		sub, args = args[0], args[1:]
+	}
+	prof := activeProfile(envDir)
+	if (sub == "list" && len(args) == 1) || (sub != "list" && len(args) == 2) {
+		prof, args = args[0], args[1:]
+	}
+
+	if sub == "list" && len(args) == 0 {
+		revs, err := profile.Revisions(envDir, prof)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "envy history: %v\n", err)
+			return 1
+		}
+		if *asJSON {
+			if revs == nil {
+				revs = []profile.Revision{}
+			}
+			printJSON(revs)
+			return 0
+		}
+		for _, rev := range revs {
+			fmt.Printf("%3d  %s  %s\n", rev.N, rev.Time.Local().Format("2006-01-02 15:04:05"), rev.Source)
+		}
+		return 0
+	}
+	if len(args) != 1 {
+		fs.Usage()
+		return 2
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		fs.Usage()
+		return 2
+	}
+
+	if sub == "diff" {
+		a, b, err := diff.Revision(envDir, prof, n)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "envy history: %v\n", err)
+			return 1
+		}
+		res := diff.Compare(a, b)
+		if *asJSON {
+			printJSON(res)
+			return 0
+		}
+		for _, l := range res.Lines(a, b, diff.Options{Reveal: *reveal, Patterns: secretPatterns(envDir)}) {
+			fmt.Printf("%c %s\n", l.Op, l.Text)
+		}
+		fmt.Println(res.Summary(a, b))
+		return 0
+	}
+
+	if err := profile.Restore(envDir, prof, n); err != nil {
+		fmt.Fprintf(os.Stderr, "envy %s: %v\n", name, err)
+		return 1
+	}
+	report(*asJSON, "restore", map[string]any{"profile": prof, "revision": n},
+		fmt.Sprintf("✓ Restored %s to revision %d", prof, n))
+	return 0
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MasFana/fana-envy/internal/importer"
+	"github.com/MasFana/fana-envy/internal/utils"
+)
+
+var importUsage = "envy " + importer.Usage + " [--json]"
+
+// importCommand creates or merges into a profile from a .env, JSON, YAML or
+// docker-compose file, or from the current environment.
+func importCommand(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	var opts importer.Options
+	opts.Register(fs)
+	asJSON := fs.Bool("json", false, "print machine readable JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: "+importUsage)
+		fs.PrintDefaults()
+	}
+	args, err := utils.ParseFlags(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(args) < 1 || len(args) > 2 {
+		fs.Usage()
+		return 2
+	}
+
+	envDir := envDirPath()
+	name := activeProfile(envDir)
+	if len(args) == 2 {
+		name = args[1]
+	}
+
+	vars, err := importer.Load(args[0], opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "envy import: %v\n", err)
+		return 1
+	}
+	res, err := importer.Merge(envDir, name, vars, opts.Overwrite)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "envy import: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		printJSON(res)
+		return 0
+	}
+	if res.Created {
+		fmt.Println("✓ Created " + name)
+	}
+	printKeys("added", res.Added)
+	printKeys("changed", res.Changed)
+	printKeys("conflicting (kept, use --overwrite)", res.Conflicts)
+	printKeys("unchanged", res.Unchanged)
+	return 0
+}
+
+func printKeys(label string, keys []string) {
+	if len(keys) > 0 {
+		fmt.Printf("%d %s: %s\n", len(keys), label, strings.Join(keys, ", "))
+	}
+}
@@ -14,31 +14,31 @@ import (
 )
 
 func main() {
-	if len(os.Args) > 1 && os.Args[1] == "open" {
-		exeDir := utils.GetExecutableDir()
-		envDir := filepath.Join(exeDir, config.EnvFolderName)
-		if err := os.MkdirAll(envDir, 0755); err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating directory: %v\n", err)
-			os.Exit(1)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "open":
+			openEnvDir()
+			return
+		case "run":
+			os.Exit(runCommand(os.Args[2:]))
+		case "list", "show", "set", "unset", "new", "rename", "delete", "switch":
+			os.Exit(profileCommand(os.Args[1], os.Args[2:]))
+		case "export":
+			os.Exit(exportCommand(os.Args[2:]))
+		case "import":
+			os.Exit(importCommand(os.Args[2:]))
+		case "merge", "copy-keys":
+			os.Exit(mergeCommand(os.Args[1], os.Args[2:]))
+		case "history", "undo":
+			os.Exit(historyCommand(os.Args[1], os.Args[2:]))
+		case "diff":
+			os.Exit(diffCommand(os.Args[2:]))
+		case "secret":
+			os.Exit(secretCommand(os.Args[2:]))
+		case "help", "-h", "--help":
+			printUsage()
+			return
 		}
-
-		fmt.Printf("Opening %s...\n", envDir)
-
-		var cmd *exec.Cmd
-		switch runtime.GOOS {
-		case "windows":
-			cmd = exec.Command("explorer", envDir)
-		case "darwin":
-			cmd = exec.Command("open", envDir)
-		default:
-			cmd = exec.Command("xdg-open", envDir)
-		}
-
-		if err := cmd.Start(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error opening folder: %v\n", err)
-			os.Exit(1)
-		}
-		return
 	}
 
 	setupConsole()
@@ -49,8 +49,59 @@ func main() {
 		tea.WithMouseCellMotion(),
 	)
 
-	if _, err := p.Run(); err != nil {
+	final, err := p.Run()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	if m, ok := final.(tui.Model); ok && m.ExitErr != nil {
+		fmt.Fprintf(os.Stderr, "Could not save state: %v\n", m.ExitErr)
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	fmt.Println(`Usage:
+  envy                      Start the interactive TUI
+  envy open                 Open the envs folder
+  envy run [-p profile] [--] [KEY=VALUE...] command [args...]`)
+	for _, name := range []string{"list", "show", "set", "unset", "new", "rename", "delete", "switch"} {
+		fmt.Println("  " + profileUsage[name])
+	}
+	fmt.Println("  " + exportUsage)
+	fmt.Println("  " + importUsage)
+	fmt.Println("  " + diffUsage)
+	fmt.Println("  " + mergeUsage)
+	fmt.Println("  " + copyKeysUsage)
+	fmt.Println("  " + historyUsage)
+	fmt.Println("  " + secretUsage)
+}
+
+func envDirPath() string {
+	return filepath.Join(utils.GetExecutableDir(), config.EnvFolderName)
+}
+
+func openEnvDir() {
+	envDir := envDirPath()
+	if err := os.MkdirAll(envDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Opening %s...\n", envDir)
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("explorer", envDir)
+	case "darwin":
+		cmd = exec.Command("open", envDir)
+	default:
+		cmd = exec.Command("xdg-open", envDir)
+	}
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening folder: %v\n", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MasFana/fana-envy/internal/importer"
+	"github.com/MasFana/fana-envy/internal/merge"
+	"github.com/MasFana/fana-envy/internal/utils"
+)
+
+var (
+	mergeUsage    = "envy " + merge.MergeUsage + " [--json]"
+	copyKeysUsage = "envy " + merge.CopyKeysUsage + " [--json]"
+)
+
+// mergeCommand runs `merge` and `copy-keys`. Conflicts must be decided up
+// front with --ours or --theirs; otherwise nothing is written.
+func mergeCommand(name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	var base string
+	var include []string
+	if name == "merge" {
+		fs.StringVar(&base, "base", "", "common ancestor profile for a three-way merge")
+		fs.Var((*importer.GlobList)(&include), "include", "only merge keys matching GLOB (repeatable)")
+	}
+	ours := fs.Bool("ours", false, "keep the target value on conflicts")
+	theirs := fs.Bool("theirs", false, "take the source value on conflicts")
+	asJSON := fs.Bool("json", false, "print machine readable JSON")
+	usage := mergeUsage
+	if name == "copy-keys" {
+		usage = copyKeysUsage
+	}
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: "+usage)
+		fs.PrintDefaults()
+	}
+	args, err := utils.ParseFlags(fs, args)
+	if err != nil {
+		return 2
+	}
+	if name == "copy-keys" && len(args) > 2 {
+		include, args = args[2:], args[:2]
+	}
+	if len(args) != 2 || (*ours && *theirs) {
+		fs.Usage()
+		return 2
+	}
+
+	envDir := envDirPath()
+	plan, err := merge.New(envDir, args[0], args[1], base, include)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "envy %s: %v\n", name, err)
+		return 1
+	}
+	switch {
+	case *ours:
+		plan.Resolve(merge.KeepMine)
+	case *theirs:
+		plan.Resolve(merge.TakeTheirs)
+	}
+
+	var conflicts []string
+	for _, c := range plan.Conflicts {
+		conflicts = append(conflicts, c.Key)
+	}
+	if plan.Unresolved() > 0 {
+		fmt.Fprintf(os.Stderr, "envy %s: %d conflicts, nothing written (use --ours or --theirs): %s\n",
+			name, len(conflicts), strings.Join(conflicts, ", "))
+		return 1
+	}
+	if err := merge.Apply(envDir, plan); err != nil {
+		fmt.Fprintf(os.Stderr, "envy %s: %v\n", name, err)
+		return 1
+	}
+
+	var set []string
+	for _, v := range plan.Set {
+		set = append(set, v.Key)
+	}
+	if *asJSON {
+		printJSON(map[string]any{
+			"action": name, "from": plan.From, "into": plan.Into,
+			"set": orEmpty(set), "deleted": orEmpty(plan.Delete), "conflicts": orEmpty(conflicts), "unchanged": plan.Unchanged,
+		})
+		return 0
+	}
+	printKeys("set", set)
+	printKeys("deleted", plan.Delete)
+	printKeys("conflicts resolved", conflicts)
+	fmt.Printf("✓ Merged %s into %s\n", plan.From, plan.Into)
+	return 0
+}
+
+func orEmpty(keys []string) []string {
+	if keys == nil {
+		return []string{}
+	}
+	return keys
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/MasFana/fana-envy/internal/config"
+	"github.com/MasFana/fana-envy/internal/dotenv"
+	"github.com/MasFana/fana-envy/internal/profile"
+	"github.com/MasFana/fana-envy/internal/utils"
+)
+
+var errUsage = errors.New("usage")
+
+// profileUsage lists the non-interactive profile commands
+var profileUsage = map[string]string{
+	"list":   "envy list [--json]",
+	"show":   "envy show [--json] [--child] [--reveal] [profile]",
+	"set":    "envy set [--json] [--secret] <profile> KEY [--] VALUE",
+	"unset":  "envy unset [--json] [--hide] <profile> KEY",
+	"new":    "envy new [--json] <profile>",
+	"rename": "envy rename [--json] <old> <new>",
+	"delete": "envy delete [--json] <profile>",
+	"switch": "envy switch [--json] <profile>",
+}
+
+func printJSON(v any) {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(data))
+}
+
+// profileCommand runs one of the profile management subcommands and
+// returns the process exit code.
+func profileCommand(name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print machine readable JSON")
+	var child, reveal, secret, hide bool
+	switch name {
+	case "show":
+		fs.BoolVar(&child, "child", false, "show the full environment a command would receive")
+		fs.BoolVar(&reveal, "reveal", false, "print secret values instead of masking them")
+	case "set":
+		fs.BoolVar(&secret, "secret", false, "store the value encrypted")
+	case "unset":
+		fs.BoolVar(&hide, "hide", false, "also hide the value from the host environment with @unset")
+	}
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: "+profileUsage[name])
+		fs.PrintDefaults()
+	}
+	until := -1
+	if name == "set" {
+		// The value is taken as is once profile and key are known
+		until = 2
+	}
+	args, err := utils.ParseFlagsUntil(fs, args, until)
+	if err != nil {
+		return 2
+	}
+
+	envDir := envDirPath()
+	if err := os.MkdirAll(envDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "envy %s: %v\n", name, err)
+		return 1
+	}
+
+	switch name {
+	case "list":
+		err = cmdList(envDir, args, *asJSON)
+	case "show":
+		err = cmdShow(envDir, args, *asJSON, child, reveal)
+	case "set":
+		err = cmdSet(envDir, args, *asJSON, secret)
+	case "unset":
+		err = cmdUnset(envDir, args, *asJSON, hide)
+	case "new":
+		err = cmdNew(envDir, args, *asJSON)
+	case "rename":
+		err = cmdRename(envDir, args, *asJSON)
+	case "delete":
+		err = cmdDelete(envDir, args, *asJSON)
+	case "switch":
+		err = cmdSwitch(envDir, args, *asJSON)
+	}
+
+	if err == errUsage {
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "envy %s: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+// secretPatterns returns the configured key globs of secret values
+func secretPatterns(envDir string) []string {
+	if patterns := config.LoadConfig(envDir).SecretPatterns; patterns != nil {
+		return patterns
+	}
+	return profile.DefaultSecretPatterns
+}
+
+func activeProfile(envDir string) string {
+	if name := config.LoadConfig(envDir).LastProfile; name != "" {
+		return name
+	}
+	return profile.DefaultName
+}
+
+func cmdList(envDir string, args []string, asJSON bool) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	names, err := profile.List(envDir)
+	if err != nil {
+		return err
+	}
+	active := activeProfile(envDir)
+
+	if asJSON {
+		type entry struct {
+			Name   string `json:"name"`
+			Active bool   `json:"active"`
+		}
+		entries := []entry{}
+		for _, n := range names {
+			entries = append(entries, entry{n, n == active})
+		}
+		printJSON(entries)
+		return nil
+	}
+	for _, n := range names {
+		mark := "  "
+		if n == active {
+			mark = "* "
+		}
+		fmt.Println(mark + n)
+	}
+	return nil
+}
+
+// cmdShow prints the variables of a profile, with secret values masked
+// unless reveal is set.
+func cmdShow(envDir string, args []string, asJSON, child, reveal bool) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	name := activeProfile(envDir)
+	if len(args) == 1 {
+		name = args[0]
+	}
+	if !profile.Exists(envDir, name) {
+		return profile.ErrNotFound
+	}
+
+	env := profile.Resolve(envDir, name, os.LookupEnv)
+	for _, err := range env.Errors {
+		fmt.Fprintf(os.Stderr, "envy: %v\n", err)
+	}
+
+	patterns := secretPatterns(envDir)
+	value := func(k, v string) string {
+		if !reveal && env.IsSecret(k, patterns) {
+			return profile.Masked
+		}
+		return v
+	}
+
+	vars := env.Vars
+	if child {
+		vars = make(map[string]string)
+		dir, _ := os.Getwd()
+		for _, kv := range env.ChildEnv(dir, nil, nil) {
+			k, v, _ := strings.Cut(kv, "=")
+			vars[k] = v
+		}
+	}
+	shown := make(map[string]string, len(vars))
+	for k, v := range vars {
+		shown[k] = value(k, v)
+	}
+
+	if asJSON {
+		if child {
+			printJSON(map[string]any{"name": name, "isolated": env.Isolated, "env": shown})
+			return nil
+		}
+		errs := []string{}
+		for _, err := range env.Errors {
+			errs = append(errs, err.Error())
+		}
+		printJSON(map[string]any{
+			"name":     name,
+			"chain":    env.Chain,
+			"vars":     shown,
+			"sources":  env.Sources,
+			"isolated": env.Isolated,
+			"errors":   errs,
+		})
+		return nil
+	}
+
+	keys := make([]string, 0, len(shown))
+	for k := range shown {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Println(k + "=" + dotenv.Quote(shown[k]))
+	}
+	return nil
+}
+
+func cmdSet(envDir string, args []string, asJSON, secret bool) error {
+	if len(args) < 3 {
+		return errUsage
+	}
+	name, key, value := args[0], args[1], strings.Join(args[2:], " ")
+	set, text := profile.Set, "✓ Set "+key
+	if secret {
+		set, text = profile.SetSecret, "✓ Set "+key+" (encrypted)"
+	}
+	if err := set(envDir, name, key, value); err != nil {
+		return err
+	}
+	report(asJSON, "set", map[string]any{"profile": name, "key": key, "encrypted": secret}, text)
+	return nil
+}
+
+func cmdUnset(envDir string, args []string, asJSON, hide bool) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	name, key := args[0], args[1]
+	found, err := profile.Unset(envDir, name, key)
+	if err != nil {
+		return err
+	}
+
+	// A parent's value would take over, so hide it. Hiding the host's, such
+	// as PATH, is rarely meant and needs --hide.
+	env := profile.Resolve(envDir, name, os.LookupEnv)
+	_, inherited := env.Vars[key]
+	fromHost := !inherited && slices.ContainsFunc(profile.BuildEnv(env, nil, nil), func(kv string) bool { return strings.HasPrefix(kv, key+"=") })
+	hidden := inherited || hide && fromHost
+	if hidden {
+		if err := profile.UnsetInherited(envDir, name, key); err != nil {
+			return err
+		}
+	}
+
+	msg := "✓ Unset " + key
+	switch {
+	case inherited:
+		msg += " (added @unset to hide the value inherited through @extends)"
+	case hidden:
+		msg += " (added @unset to hide the host's value)"
+	case fromHost:
+		msg += "; commands still get it from the host, use --hide to drop it"
+	}
+	report(asJSON, "unset", map[string]any{"profile": name, "key": key, "found": found, "inherited": inherited, "host": fromHost, "hidden": hidden}, msg)
+	return nil
+}
+
+func cmdNew(envDir string, args []string, asJSON bool) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	if err := profile.Create(envDir, args[0]); err != nil {
+		return err
+	}
+	report(asJSON, "new", map[string]any{"profile": args[0]}, "✓ Created "+args[0])
+	return nil
+}
+
+func cmdRename(envDir string, args []string, asJSON bool) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	oldName, newName := args[0], args[1]
+	if err := profile.Rename(envDir, oldName, newName); err != nil {
+		return err
+	}
+	if activeProfile(envDir) == oldName {
+		if err := config.SaveConfig(envDir, newName); err != nil {
+			return err
+		}
+	}
+	report(asJSON, "rename", map[string]any{"from": oldName, "to": newName}, "✓ Renamed "+oldName+" to "+newName)
+	return nil
+}
+
+func cmdDelete(envDir string, args []string, asJSON bool) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	name := args[0]
+	if name == activeProfile(envDir) {
+		return errors.New("cannot delete active profile")
+	}
+	if err := profile.Delete(envDir, name); err != nil {
+		return err
+	}
+	report(asJSON, "delete", map[string]any{"profile": name}, "✓ Deleted "+name)
+	return nil
+}
+
+func cmdSwitch(envDir string, args []string, asJSON bool) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	name := args[0]
+	if !profile.Exists(envDir, name) {
+		return profile.ErrNotFound
+	}
+	if err := config.SaveConfig(envDir, name); err != nil {
+		return err
+	}
+	report(asJSON, "switch", map[string]any{"profile": name}, "✓ Switched to "+name)
+	return nil
+}
+
+func report(asJSON bool, action string, fields map[string]any, text string) {
+	if asJSON {
+		fields["action"] = action
+		printJSON(fields)
+		return
+	}
+	fmt.Println(text)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/MasFana/fana-envy/internal/config"
+	"github.com/MasFana/fana-envy/internal/profile"
+	"github.com/MasFana/fana-envy/internal/secrets"
+	"github.com/MasFana/fana-envy/internal/utils"
+)
+
+// runCommand executes a command under a profile without starting the TUI
+// and returns the exit code to use.
+func runCommand(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	var name string
+	fs.StringVar(&name, "p", "", "profile to load (default: last used profile)")
+	fs.StringVar(&name, "profile", "", "profile to load (default: last used profile)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: envy run [-p profile] [--] [KEY=VALUE...] command [args...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	overrides, argv := utils.SplitAssignments(fs.Args())
+	if len(argv) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	envDir := envDirPath()
+	cfg := config.LoadConfig(envDir)
+	if name == "" {
+		name = cfg.LastProfile
+	}
+	if name == "" {
+		name = "default"
+	}
+	if _, err := os.Stat(profile.Path(envDir, name)); err != nil {
+		fmt.Fprintf(os.Stderr, "envy: profile not found: %s\n", name)
+		return 1
+	}
+
+	env := profile.Resolve(envDir, name, os.LookupEnv)
+	for _, err := range env.Errors {
+		fmt.Fprintf(os.Stderr, "envy: %v\n", err)
+	}
+
+	dir, _ := os.Getwd()
+	resolver := secrets.NewResolver(cfg.FetchTimeout())
+	environ, _, err := resolver.Environ(env.ChildEnv(dir, nil, overrides), env.Vars, dir)
+	if err != nil {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(os.Stderr, "envy: secret: %s\n", line)
+		}
+		return 1
+	}
+	if len(env.Schemas) > 0 {
+		problems := env.Check(dir, environ)
+		for _, err := range problems {
+			fmt.Fprintf(os.Stderr, "envy: schema: %v\n", err)
+		}
+		if len(problems) > 0 && env.Strict {
+			fmt.Fprintf(os.Stderr, "envy: %s is @strict and does not match its schema\n", name)
+			return 1
+		}
+	}
+
+	c := exec.Command(argv[0], argv[1:]...)
+	c.Env = environ
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	if err := c.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "envy: %v\n", err)
+		return 127
+	}
+
+	// The child shares envy's process group, so in the terminal's
+	// foreground it gets ^C and ^\ itself; relaying them too would deliver
+	// them twice. They are still caught to keep envy alive until the child
+	// exits. In the background they come from kill and are relayed.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardedSignals...)
+	go func() {
+		for sig := range sigs {
+			if slices.Contains(ttySignals, sig) && inForeground() {
+				continue
+			}
+			c.Process.Signal(sig)
+		}
+	}()
+
+	err = c.Wait()
+	signal.Stop(sigs)
+	close(sigs)
+
+	if c.ProcessState == nil {
+		fmt.Fprintf(os.Stderr, "envy: %v\n", err)
+		return 1
+	}
+	if ws, ok := c.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return c.ProcessState.ExitCode()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MasFana/fana-envy/internal/profile"
+	"github.com/MasFana/fana-envy/internal/utils"
+)
+
+const secretUsage = "envy secret rotate [--json]"
+
+// secretCommand manages the key encrypted values are stored with. `rotate`
+// re-encrypts every secret in every profile with a new key.
+func secretCommand(args []string) int {
+	fs := flag.NewFlagSet("secret", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print machine readable JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: "+secretUsage)
+		fs.PrintDefaults()
+	}
+	args, err := utils.ParseFlags(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(args) != 1 || args[0] != "rotate" {
+		fs.Usage()
+		return 2
+	}
+
+	rot, err := profile.RotateKey(envDirPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "envy secret: %v\n", err)
+		return 1
+	}
+	total := 0
+	for _, n := range rot.Values {
+		total += n
+	}
+	text := fmt.Sprintf("✓ Rotated key, re-encrypted %d values in %d profiles and %d history revisions", total, len(rot.Values), rot.Revisions)
+	if rot.Purged > 0 {
+		text += fmt.Sprintf("\n  Deleted %d revisions with values of an older key", rot.Purged)
+	}
+	report(*asJSON, "rotate", map[string]any{"profiles": rot.Values, "values": total, "revisions": rot.Revisions, "purged": rot.Purged}, text)
+	return 0
+}
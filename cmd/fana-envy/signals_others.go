@@ -0,0 +1,32 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Signals relayed from envy to the child started by `envy run`
+var forwardedSignals = []os.Signal{
+	os.Interrupt,
+	syscall.SIGTERM,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+	syscall.SIGWINCH,
+}
+
+// Signals the terminal sends to the whole foreground process group, child
+// included, when the user types ^C or ^\
+var ttySignals = []os.Signal{os.Interrupt, syscall.SIGQUIT}
+
+// inForeground reports whether envy's process group, which the child
+// shares, is the foreground group of the terminal on stdin
+func inForeground() bool {
+	pgrp, err := unix.IoctlGetInt(int(os.Stdin.Fd()), unix.TIOCGPGRP)
+	return err == nil && pgrp == unix.Getpgrp()
+}
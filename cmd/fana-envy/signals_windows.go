@@ -0,0 +1,19 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// Console Ctrl+C already reaches the child; catching it keeps envy alive
+// until the child exits so its exit code can be returned.
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// Signals the console already delivered to the child
+var ttySignals = []os.Signal{os.Interrupt}
+
+// inForeground reports whether stdin is the console, which delivered
+// Ctrl+C to the child as well
+func inForeground() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,111 @@
+// Package binding ties directories to profiles, so that `cd` into a
+// project switches to its profile. A directory is bound either in the
+// config (`bind`) or by an .envy file naming the profile, which is shared
+// with the repository and therefore has to be trusted first.
+package binding
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MasFana/fana-envy/internal/config"
+	"github.com/MasFana/fana-envy/internal/utils"
+)
+
+// MarkerFile names the profile for its directory and everything below it
+const MarkerFile = ".envy"
+
+const (
+	BindUsage   = "bind [<profile> [dir]]"
+	UnbindUsage = "unbind [dir]"
+)
+
+// Binding is the profile that applies to a directory tree
+type Binding struct {
+	Dir     string // Root of the bound tree
+	Profile string
+	Marker  string // Path of the .envy file, empty for a binding in the config
+	Hash    string // Hash of the .envy file, to notice when it changes
+}
+
+// Find returns the binding of dir or its nearest bound parent, nil when
+// there is none. Config bindings win over a marker in the same directory.
+func Find(cfg config.AppConfig, dir string) (*Binding, error) {
+	for d := filepath.Clean(dir); ; {
+		if name, ok := cfg.DirProfiles[d]; ok {
+			return &Binding{Dir: d, Profile: name}, nil
+		}
+		marker := filepath.Join(d, MarkerFile)
+		if data, err := os.ReadFile(marker); err == nil {
+			name, err := parseMarker(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", marker, err)
+			}
+			sum := sha256.Sum256(data)
+			return &Binding{Dir: d, Profile: name, Marker: marker, Hash: hex.EncodeToString(sum[:])}, nil
+		}
+
+		parent := filepath.Dir(d)
+		if parent == d {
+			return nil, nil
+		}
+		d = parent
+	}
+}
+
+// parseMarker returns the profile name, the first line that is not blank
+// or a # comment
+func parseMarker(data []byte) (string, error) {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !utils.IsValidProfileName(line) {
+			return "", fmt.Errorf("invalid profile name %q", line)
+		}
+		return line, nil
+	}
+	return "", fmt.Errorf("no profile name")
+}
+
+// Trusted reports whether b may switch profiles. Config bindings were made
+// by the user; a marker is trusted until its content changes.
+func (b *Binding) Trusted(cfg config.AppConfig) bool {
+	return b.Marker == "" || cfg.TrustedDirs[b.Dir] == b.Hash
+}
+
+// Trust lets the marker of b switch profiles
+func Trust(envDir string, b *Binding) error {
+	return config.Update(envDir, func(c *config.AppConfig) {
+		if c.TrustedDirs == nil {
+			c.TrustedDirs = make(map[string]string)
+		}
+		c.TrustedDirs[b.Dir] = b.Hash
+	})
+}
+
+// Bind makes dir switch to profile
+func Bind(envDir, dir, profile string) error {
+	return config.Update(envDir, func(c *config.AppConfig) {
+		if c.DirProfiles == nil {
+			c.DirProfiles = make(map[string]string)
+		}
+		c.DirProfiles[filepath.Clean(dir)] = profile
+	})
+}
+
+// Unbind removes the config binding of dir and reports whether there was
+// one
+func Unbind(envDir, dir string) (bool, error) {
+	found := false
+	err := config.Update(envDir, func(c *config.AppConfig) {
+		_, found = c.DirProfiles[filepath.Clean(dir)]
+		delete(c.DirProfiles, filepath.Clean(dir))
+	})
+	return found, err
+}
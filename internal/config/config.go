@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/MasFana/fana-envy/internal/storage"
 )
 
 const (
@@ -12,10 +15,70 @@ const (
 	EnvFolderName = "envs"
 	ConfigName    = ".fana_config"
 	HistoryFile   = ".fana_history"
+
+	DefaultKillTimeout   = 3 * time.Second
+	DefaultRevealTimeout = 15 * time.Second
+	DefaultHistoryKeep   = 50
 )
 
 type AppConfig struct {
-	LastProfile string `json:"last_profile"`
+	LastProfile string          `json:"last_profile"`
+	KillTimeout string          `json:"kill_timeout,omitempty"` // Grace period before escalating a kill, e.g. "5s"
+	Terminals   []TerminalState `json:"terminals,omitempty"`    // Restored on the next start
+
+	SecretPatterns []string `json:"secret_patterns,omitempty"` // Key globs masked on screen, e.g. "*_TOKEN"
+	RevealTimeout  string   `json:"reveal_timeout,omitempty"`  // How long revealed secrets stay visible
+	SecretTimeout  string   `json:"secret_timeout,omitempty"`  // Limit for fetching one `@cmd:`/`@file:` value
+
+	HistoryKeep int `json:"history_keep,omitempty"` // Revisions kept per profile
+	HistoryDays int `json:"history_days,omitempty"` // Drop revisions older than this, 0 keeps them
+
+	DirProfiles map[string]string `json:"dir_profiles,omitempty"` // Directory -> profile switched to on `cd`
+	TrustedDirs map[string]string `json:"trusted_dirs,omitempty"` // Directory -> hash of the .envy file allowed to switch
+}
+
+// TerminalState is what is remembered about a terminal pane between runs
+type TerminalState struct {
+	Dir     string `json:"dir"`
+	Profile string `json:"profile,omitempty"`
+}
+
+// KillGrace returns how long a stopped process gets before the next,
+// stronger signal is sent.
+func (c AppConfig) KillGrace() time.Duration {
+	if d, err := time.ParseDuration(c.KillTimeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultKillTimeout
+}
+
+// RevealFor returns how long secrets stay visible after revealing them
+func (c AppConfig) RevealFor() time.Duration {
+	if d, err := time.ParseDuration(c.RevealTimeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultRevealTimeout
+}
+
+// FetchTimeout returns how long a secret provider may take, or 0 to use
+// the provider default.
+func (c AppConfig) FetchTimeout() time.Duration {
+	d, _ := time.ParseDuration(c.SecretTimeout)
+	return d
+}
+
+// HistoryLimit returns how many revisions are kept per profile
+func (c AppConfig) HistoryLimit() int {
+	if c.HistoryKeep > 0 {
+		return c.HistoryKeep
+	}
+	return DefaultHistoryKeep
+}
+
+// HistoryMaxAge returns the age after which revisions are dropped, or 0
+// to keep them regardless of age
+func (c AppConfig) HistoryMaxAge() time.Duration {
+	return time.Duration(c.HistoryDays) * 24 * time.Hour
 }
 
 func LoadConfig(envDir string) AppConfig {
@@ -25,8 +88,21 @@ func LoadConfig(envDir string) AppConfig {
 	return config
 }
 
-func SaveConfig(envDir string, lastProfile string) {
-	config := AppConfig{LastProfile: lastProfile}
-	data, _ := json.MarshalIndent(config, "", "  ")
-	os.WriteFile(filepath.Join(envDir, ConfigName), data, 0644)
+// Update applies edit to the config on disk and writes it back. Other
+// instances wait, so settings they saved in the meantime are kept.
+func Update(envDir string, edit func(*AppConfig)) error {
+	return storage.Locked(envDir, func() error {
+		config := LoadConfig(envDir)
+		edit(&config)
+		data, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return err
+		}
+		return storage.WriteFile(filepath.Join(envDir, ConfigName), data, 0644)
+	})
+}
+
+// SaveConfig records the last used profile, keeping the other settings
+func SaveConfig(envDir string, lastProfile string) error {
+	return Update(envDir, func(c *AppConfig) { c.LastProfile = lastProfile })
 }
@@ -0,0 +1,170 @@
+// Package diff compares the variables of two profiles, .env files or the
+// host environment.
+package diff
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/MasFana/fana-envy/internal/importer"
+	"github.com/MasFana/fana-envy/internal/profile"
+)
+
+// HostSource names the live host environment; the import name works too
+const HostSource = "@host"
+
+const Usage = "diff [--keys-only] [--reveal] <a> <b>"
+
+// Side is one of the compared sets of variables
+type Side struct {
+	Label string
+	Vars  map[string]string
+	Env   *profile.Env // Set when the side is a profile
+}
+
+// Load resolves spec: a profile name, HostSource or importer.EnvSource,
+// or a .env/JSON/YAML file, relative to dir. A profile wins over a file
+// of the same name; use ./name for the file.
+func Load(envDir, dir, spec string) (*Side, error) {
+	switch {
+	case spec == HostSource || spec == importer.EnvSource:
+		vars := make(map[string]string)
+		for _, kv := range os.Environ() {
+			if k, v, ok := strings.Cut(kv, "="); ok && k != "" {
+				vars[k] = v
+			}
+		}
+		return &Side{Label: "host", Vars: vars}, nil
+
+	case profile.Exists(envDir, spec):
+		env := profile.Resolve(envDir, spec, os.LookupEnv)
+		return &Side{Label: spec, Vars: env.Vars, Env: env}, nil
+	}
+
+	path := spec
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	vars, err := importer.Load(path, importer.Options{})
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: no such profile or file", spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	side := &Side{Label: spec, Vars: make(map[string]string)}
+	for _, v := range vars {
+		side.Vars[v.Key] = v.Value
+	}
+	return side, nil
+}
+
+// Result lists the keys that differ between A and B, sorted
+type Result struct {
+	OnlyA   []string `json:"only_a"`
+	OnlyB   []string `json:"only_b"`
+	Changed []string `json:"changed"`
+	Same    int      `json:"same"`
+}
+
+// Compare returns how the variables of b differ from a
+func Compare(a, b *Side) Result {
+	res := Result{OnlyA: []string{}, OnlyB: []string{}, Changed: []string{}}
+	for k, va := range a.Vars {
+		vb, ok := b.Vars[k]
+		switch {
+		case !ok:
+			res.OnlyA = append(res.OnlyA, k)
+		case va != vb:
+			res.Changed = append(res.Changed, k)
+		default:
+			res.Same++
+		}
+	}
+	for k := range b.Vars {
+		if _, ok := a.Vars[k]; !ok {
+			res.OnlyB = append(res.OnlyB, k)
+		}
+	}
+	sort.Strings(res.OnlyA)
+	sort.Strings(res.OnlyB)
+	sort.Strings(res.Changed)
+	return res
+}
+
+// Empty reports whether both sides hold the same variables
+func (r Result) Empty() bool {
+	return len(r.OnlyA)+len(r.OnlyB)+len(r.Changed) == 0
+}
+
+// Op tells how a key differs: '-' only in A, '+' only in B, '~' changed
+type Op byte
+
+// Line is one printed difference
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Options control how differences are printed
+type Options struct {
+	KeysOnly bool
+	Reveal   bool     // Print secret values instead of masking them
+	Patterns []string // Secret key patterns, see profile.MatchesSecret
+}
+
+// Lines formats the result as `- KEY=value`, `+ KEY=value` and
+// `~ KEY: old → new` lines.
+func (r Result) Lines(a, b *Side, opts Options) []Line {
+	show := func(k, v string) string {
+		if !opts.Reveal && r.secret(a, b, k, opts.Patterns) {
+			return profile.Masked
+		}
+		return v
+	}
+
+	var lines []Line
+	for _, k := range r.OnlyA {
+		text := k
+		if !opts.KeysOnly {
+			text += "=" + show(k, a.Vars[k])
+		}
+		lines = append(lines, Line{'-', text})
+	}
+	for _, k := range r.OnlyB {
+		text := k
+		if !opts.KeysOnly {
+			text += "=" + show(k, b.Vars[k])
+		}
+		lines = append(lines, Line{'+', text})
+	}
+	for _, k := range r.Changed {
+		text := k
+		if !opts.KeysOnly {
+			text += ": " + show(k, a.Vars[k]) + " → " + show(k, b.Vars[k])
+		}
+		lines = append(lines, Line{'~', text})
+	}
+	return lines
+}
+
+func (r Result) secret(a, b *Side, key string, patterns []string) bool {
+	for _, s := range []*Side{a, b} {
+		if s.Env != nil && s.Env.IsSecret(key, patterns) {
+			return true
+		}
+	}
+	return profile.MatchesSecret(key, patterns)
+}
+
+// Summary is the one line total printed after the differences
+func (r Result) Summary(a, b *Side) string {
+	if r.Empty() {
+		return a.Label + " and " + b.Label + " have the same variables"
+	}
+	return fmt.Sprintf("%d only in %s, %d only in %s, %d changed, %d same",
+		len(r.OnlyA), a.Label, len(r.OnlyB), b.Label, len(r.Changed), r.Same)
+}
@@ -0,0 +1,42 @@
+package diff
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/MasFana/fana-envy/internal/profile"
+)
+
+// Revision loads revision n of a profile and the current file as they are
+// written, without inheritance, so only edits to the file show up. Keys
+// marked `# @secret` in either are masked like in profile diffs.
+func Revision(envDir, name string, n int) (*Side, *Side, error) {
+	rev, err := profile.GetRevision(envDir, name, n)
+	if err != nil {
+		return nil, nil, err
+	}
+	old, err := fileSide(rev.Path, fmt.Sprintf("revision %d", n))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current := &Side{Label: name, Vars: map[string]string{}}
+	if profile.Exists(envDir, name) {
+		if current, err = fileSide(profile.Path(envDir, name), name); err != nil {
+			return nil, nil, err
+		}
+	}
+	return old, current, nil
+}
+
+func fileSide(path, label string) (*Side, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	env, err := profile.FileEnv(label, string(content))
+	if err != nil {
+		return nil, err
+	}
+	return &Side{Label: label, Vars: env.Vars, Env: env}, nil
+}
@@ -0,0 +1,431 @@
+package dotenv
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NodeKind identifies what a single entry of a Document holds
+type NodeKind int
+
+const (
+	Blank NodeKind = iota
+	Comment
+	Variable
+)
+
+// Node is one logical line of a .env file. A quoted value may span
+// several physical lines.
+type Node struct {
+	Kind    NodeKind
+	Raw     string // Original source text, empty once the node is modified
+	Key     string
+	Value   string
+	Quote   byte // Quote character the value was written with, 0 if bare
+	Export  bool
+	Comment string // Trailing inline comment, without the leading '#'
+	Line    int
+}
+
+// Document is a parsed .env file that keeps comments, blank lines and
+// ordering so it can be written back without losing anything.
+type Document struct {
+	Nodes []*Node
+}
+
+type ParseError struct {
+	Line int
+	Col  int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d, col %d: %s", e.Line, e.Col, e.Msg)
+}
+
+type parser struct {
+	src       string
+	pos       int
+	line      int
+	lineStart int
+}
+
+// Parse reads .env source. On a syntax error it returns the nodes parsed
+// before the error together with a *ParseError.
+func Parse(src string) (*Document, error) {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	p := &parser{src: src, line: 1}
+	doc := &Document{}
+
+	for p.pos < len(p.src) {
+		start := p.pos
+		node, err := p.parseLine()
+		if err != nil {
+			return doc, err
+		}
+		node.Raw = strings.TrimSuffix(p.src[start:p.pos], "\n")
+		doc.Nodes = append(doc.Nodes, node)
+	}
+	return doc, nil
+}
+
+func (p *parser) errorf(pos int, format string, args ...any) *ParseError {
+	line, lineStart := p.line, p.lineStart
+	// pos may point back into an earlier line for unterminated quotes
+	for lineStart > pos {
+		prev := strings.LastIndexByte(p.src[:lineStart-1], '\n')
+		lineStart = prev + 1
+		line--
+	}
+	return &ParseError{
+		Line: line,
+		Col:  utf8.RuneCountInString(p.src[lineStart:pos]) + 1,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *parser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// endLine consumes the rest of the current line including the newline
+func (p *parser) endLine() {
+	if i := strings.IndexByte(p.src[p.pos:], '\n'); i >= 0 {
+		p.pos += i + 1
+		p.line++
+		p.lineStart = p.pos
+	} else {
+		p.pos = len(p.src)
+	}
+}
+
+func (p *parser) newline() {
+	p.pos++
+	p.line++
+	p.lineStart = p.pos
+}
+
+func (p *parser) parseLine() (*Node, error) {
+	node := &Node{Line: p.line}
+	p.skipSpace()
+
+	switch p.peek() {
+	case '\n', 0:
+		node.Kind = Blank
+		p.endLine()
+		return node, nil
+	case '#':
+		node.Kind = Comment
+		p.endLine()
+		return node, nil
+	}
+
+	node.Kind = Variable
+	if strings.HasPrefix(p.src[p.pos:], "export") {
+		rest := p.src[p.pos+len("export"):]
+		if len(rest) > 0 && (rest[0] == ' ' || rest[0] == '\t') {
+			node.Export = true
+			p.pos += len("export")
+			p.skipSpace()
+		}
+	}
+
+	keyStart := p.pos
+	for p.pos < len(p.src) {
+		ch, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if !unicode.IsLetter(ch) && !unicode.IsDigit(ch) && ch != '_' {
+			break
+		}
+		p.pos += size
+	}
+	node.Key = p.src[keyStart:p.pos]
+	if node.Key == "" {
+		return nil, p.errorf(p.pos, "expected variable name")
+	}
+	if ch, _ := utf8.DecodeRuneInString(node.Key); unicode.IsDigit(ch) {
+		return nil, p.errorf(keyStart, "variable name %q starts with a digit", node.Key)
+	}
+
+	p.skipSpace()
+	if p.peek() != '=' {
+		return nil, p.errorf(p.pos, "expected '=' after %s", node.Key)
+	}
+	p.pos++
+	p.skipSpace()
+
+	switch p.peek() {
+	case '"', '\'':
+		if err := p.parseQuoted(node); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case '#':
+			p.pos++
+			node.Comment = p.restOfLine()
+		case '\n', 0:
+		default:
+			return nil, p.errorf(p.pos, "unexpected %q after closing quote", p.peek())
+		}
+	default:
+		p.parseBare(node)
+	}
+
+	p.endLine()
+	return node, nil
+}
+
+func (p *parser) restOfLine() string {
+	end := strings.IndexByte(p.src[p.pos:], '\n')
+	if end < 0 {
+		end = len(p.src) - p.pos
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end
+	return s
+}
+
+// parseBare reads an unquoted value. A '#' starts a comment only at the
+// beginning of the value or after whitespace.
+func (p *parser) parseBare(node *Node) {
+	line := p.restOfLine()
+	value := line
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			value = line[:i]
+			node.Comment = line[i+1:]
+			break
+		}
+	}
+	node.Value = strings.TrimRight(value, " \t")
+}
+
+// parseQuoted reads a single or double quoted value, which may span lines.
+// Double quoted values understand \n, \r, \t, \" and \\; other escapes are
+// kept verbatim so that later stages (interpolation) can interpret them.
+func (p *parser) parseQuoted(node *Node) error {
+	quote := p.src[p.pos]
+	open := p.pos
+	node.Quote = quote
+	p.pos++
+
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			return p.errorf(open, "unterminated %c-quoted value for %s", quote, node.Key)
+		}
+		ch := p.src[p.pos]
+		switch {
+		case ch == quote:
+			p.pos++
+			node.Value = b.String()
+			return nil
+		case ch == '\n':
+			b.WriteByte(ch)
+			p.newline()
+		case ch == '\\' && quote == '"' && p.pos+1 < len(p.src):
+			next := p.src[p.pos+1]
+			switch next {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\':
+				b.WriteByte(next)
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(next)
+			}
+			p.pos += 2
+			if next == '\n' {
+				p.line++
+				p.lineStart = p.pos
+			}
+		default:
+			b.WriteByte(ch)
+			p.pos++
+		}
+	}
+}
+
+// Get returns the value of the last assignment to key
+func (d *Document) Get(key string) (string, bool) {
+	for i := len(d.Nodes) - 1; i >= 0; i-- {
+		if n := d.Nodes[i]; n.Kind == Variable && n.Key == key {
+			return n.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set updates the last assignment to key in place, dropping earlier
+// duplicates, or appends a new one.
+func (d *Document) Set(key, value string) {
+	var last *Node
+	for _, n := range d.Nodes {
+		if n.Kind == Variable && n.Key == key {
+			last = n
+		}
+	}
+
+	if last == nil {
+		last = &Node{Kind: Variable, Key: key}
+		d.Nodes = append(d.Nodes, last)
+	} else {
+		kept := d.Nodes[:0]
+		for _, n := range d.Nodes {
+			if n.Kind == Variable && n.Key == key && n != last {
+				continue
+			}
+			kept = append(kept, n)
+		}
+		d.Nodes = kept
+		if last.Value == value {
+			return
+		}
+	}
+	last.Value = value
+	last.Quote = quoteChar(value)
+	last.Raw = ""
+}
+
+// SetLiteral is like Set but writes value so that interpolation leaves it
+// untouched.
+func (d *Document) SetLiteral(key, value string) {
+	if !strings.Contains(value, "$") {
+		d.Set(key, value)
+		return
+	}
+	if strings.Contains(value, "'") {
+		// Single quotes cannot hold a quote, escape the dollars instead
+		d.Set(key, strings.ReplaceAll(value, "$", `\$`))
+		return
+	}
+	d.Set(key, value)
+	for _, n := range d.Nodes {
+		if n.Kind == Variable && n.Key == key && n.Raw == "" {
+			n.Quote = '\''
+		}
+	}
+}
+
+// Unset removes every assignment to key and reports whether one existed
+func (d *Document) Unset(key string) bool {
+	found := false
+	kept := d.Nodes[:0]
+	for _, n := range d.Nodes {
+		if n.Kind == Variable && n.Key == key {
+			found = true
+			continue
+		}
+		kept = append(kept, n)
+	}
+	d.Nodes = kept
+	return found
+}
+
+// Variables returns the assignments in file order
+func (d *Document) Variables() []*Node {
+	var vars []*Node
+	for _, n := range d.Nodes {
+		if n.Kind == Variable {
+			vars = append(vars, n)
+		}
+	}
+	return vars
+}
+
+// Map returns the final value of every variable
+func (d *Document) Map() map[string]string {
+	vars := make(map[string]string)
+	for _, n := range d.Variables() {
+		vars[n.Key] = n.Value
+	}
+	return vars
+}
+
+// String serializes the document. Untouched lines are written exactly as
+// they were read.
+func (d *Document) String() string {
+	var b strings.Builder
+	for _, n := range d.Nodes {
+		b.WriteString(n.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func (n *Node) String() string {
+	if n.Raw != "" || n.Kind != Variable {
+		return n.Raw
+	}
+	s := n.Key + "=" + Quote(n.Value)
+	if n.Quote == '\'' {
+		s = n.Key + "='" + n.Value + "'"
+	}
+	if n.Export {
+		s = "export " + s
+	}
+	if n.Comment != "" {
+		s += " #" + n.Comment
+	}
+	return s
+}
+
+// Quote returns value in a form Parse reads back identically. Plain values
+// are left bare; anything else is double quoted with escapes.
+func Quote(value string) string {
+	if quoteChar(value) == 0 {
+		return value
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		switch ch := value[i]; ch {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// QuoteLiteral is like Quote but keeps '$' from being interpolated when the
+// value is read back, the same way SetLiteral writes it.
+func QuoteLiteral(value string) string {
+	switch {
+	case !strings.Contains(value, "$"):
+		return Quote(value)
+	case strings.Contains(value, "'"):
+		return Quote(strings.ReplaceAll(value, "$", `\$`))
+	}
+	return "'" + value + "'"
+}
+
+func quoteChar(value string) byte {
+	if value == "" {
+		return 0
+	}
+	if strings.TrimSpace(value) != value || strings.ContainsAny(value, "\"'`#\n\r \t") {
+		return '"'
+	}
+	return 0
+}
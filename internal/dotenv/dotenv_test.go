@@ -0,0 +1,106 @@
+package dotenv
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuoteRoundTrip(t *testing.T) {
+	values := []string{
+		"",
+		"plain",
+		"with space",
+		" padded ",
+		"tab\there",
+		"multi\nline\n",
+		"crlf\r\n",
+		`double "quotes"`,
+		"single 'quotes'",
+		`back\slash`,
+		`escaped \"quote\" and \\ pair`,
+		`literal \n escape`,
+		"hash # not a comment",
+		"trailing#hash",
+		"$HOME and ${PATH}",
+		"`backticks`",
+		"ünïcödé ✓",
+	}
+	for _, v := range values {
+		doc, err := Parse("KEY=" + Quote(v) + "\n")
+		if err != nil {
+			t.Errorf("Parse(KEY=%s): %v", Quote(v), err)
+			continue
+		}
+		if got, _ := doc.Get("KEY"); got != v {
+			t.Errorf("round trip of %q through %s = %q", v, Quote(v), got)
+		}
+	}
+}
+
+func TestSetRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		literal bool
+		value   string
+	}{
+		{"plain", false, "a b"},
+		{"literal dollar", true, "pa$$word"},
+		{"literal dollar and quote", true, "it's $5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, _ := Parse("# keep me\nOTHER=1\n")
+			if tt.literal {
+				doc.SetLiteral("KEY", tt.value)
+			} else {
+				doc.Set("KEY", tt.value)
+			}
+			reread, err := Parse(doc.String())
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", doc.String(), err)
+			}
+			values, errs := ExpandAll(VarsOf(reread), nil)
+			if len(errs) > 0 || values["KEY"] != tt.value {
+				t.Errorf("KEY after writing %q = %q, %v", doc.String(), values["KEY"], errs)
+			}
+			if !strings.HasPrefix(doc.String(), "# keep me\nOTHER=1\n") {
+				t.Errorf("untouched lines changed: %q", doc.String())
+			}
+		})
+	}
+}
+
+func TestDocumentKeepsSource(t *testing.T) {
+	src := "# comment\n\nexport A=1 # note\nB = \"two\nlines\"\nC='raw \\n'\n"
+	doc, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.String(); got != src {
+		t.Errorf("String() = %q, want %q", got, src)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+	}{
+		{"A=1\nB=\"open\n", 2},
+		{"=value", 1},
+		{"1A=x", 1},
+		{"A 1", 1},
+		{"A='x' y", 1},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		pe, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("Parse(%q) error = %v, want a *ParseError", tt.src, err)
+			continue
+		}
+		if pe.Line != tt.line {
+			t.Errorf("Parse(%q) error on line %d, want %d", tt.src, pe.Line, tt.line)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package dotenv
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Var is a raw assignment waiting to be expanded. Literal values (single
+// quoted in the source) are passed through untouched.
+type Var struct {
+	Key     string
+	Value   string
+	Literal bool
+}
+
+type ExpandError struct {
+	Key string
+	Msg string
+}
+
+func (e *ExpandError) Error() string {
+	return e.Key + ": " + e.Msg
+}
+
+// Lookup resolves names that are not defined by the vars being expanded,
+// usually os.LookupEnv.
+type Lookup func(name string) (string, bool)
+
+const (
+	unvisited = iota
+	visiting
+	done
+)
+
+type expander struct {
+	vars   []Var
+	last   map[string]int
+	lookup Lookup
+	state  []int
+	values []string
+	stack  []string
+	errs   []error
+}
+
+// VarsOf converts the assignments of a document into expandable vars
+func VarsOf(doc *Document) []Var {
+	var vars []Var
+	for _, n := range doc.Variables() {
+		vars = append(vars, Var{Key: n.Key, Value: n.Value, Literal: n.Quote == '\''})
+	}
+	return vars
+}
+
+// ExpandAll resolves ${VAR}, ${VAR:-default}, ${VAR:?error} and $VAR
+// references in vars. Names resolve to the last definition in vars, then
+// to lookup. A variable referring to itself (PATH=${PATH}:/bin) sees the
+// previous definition instead. Unresolved references and cycles are
+// returned as *ExpandError; the affected references expand to "".
+func ExpandAll(vars []Var, lookup Lookup) (map[string]string, []error) {
+	e := &expander{
+		vars:   vars,
+		last:   make(map[string]int),
+		lookup: lookup,
+		state:  make([]int, len(vars)),
+		values: make([]string, len(vars)),
+	}
+	for i, v := range vars {
+		e.last[v.Key] = i
+	}
+
+	result := make(map[string]string)
+	for i, v := range vars {
+		e.resolve(i)
+		if e.last[v.Key] == i {
+			result[v.Key] = e.values[i]
+		}
+	}
+	return result, e.errs
+}
+
+func (e *expander) resolve(i int) (string, bool) {
+	switch e.state[i] {
+	case done:
+		return e.values[i], true
+	case visiting:
+		cycle := append(append([]string{}, e.stack...), e.vars[i].Key)
+		for j, k := range cycle {
+			if k == e.vars[i].Key {
+				cycle = cycle[j:]
+				break
+			}
+		}
+		// Reported here, so the caller must not also report it as unset
+		e.fail(e.stack[len(e.stack)-1], "reference cycle "+strings.Join(cycle, " -> "))
+		return "", true
+	}
+
+	v := e.vars[i]
+	e.state[i] = visiting
+	e.stack = append(e.stack, v.Key)
+	value := v.Value
+	if !v.Literal {
+		value = e.expand(i, v.Value)
+	}
+	e.stack = e.stack[:len(e.stack)-1]
+	e.state[i] = done
+	e.values[i] = value
+	return value, true
+}
+
+// ref looks up name as seen from the variable at index i
+func (e *expander) ref(i int, name string) (string, bool) {
+	if name == e.vars[i].Key {
+		for j := i - 1; j >= 0; j-- {
+			if e.vars[j].Key == name {
+				return e.resolve(j)
+			}
+		}
+	} else if j, ok := e.last[name]; ok {
+		return e.resolve(j)
+	}
+	if e.lookup != nil {
+		return e.lookup(name)
+	}
+	return "", false
+}
+
+func (e *expander) fail(key, msg string) {
+	e.errs = append(e.errs, &ExpandError{Key: key, Msg: msg})
+}
+
+func (e *expander) expand(i int, s string) string {
+	key := e.vars[i].Key
+	var b strings.Builder
+
+	for pos := 0; pos < len(s); {
+		ch := s[pos]
+		if ch == '\\' && pos+1 < len(s) && s[pos+1] == '$' {
+			b.WriteByte('$')
+			pos += 2
+			continue
+		}
+		if ch != '$' || pos+1 >= len(s) {
+			b.WriteByte(ch)
+			pos++
+			continue
+		}
+
+		if s[pos+1] == '{' {
+			end := matchBrace(s, pos+2)
+			if end < 0 {
+				e.fail(key, "unterminated ${ in value")
+				b.WriteString(s[pos:])
+				break
+			}
+			b.WriteString(e.substitute(i, s[pos+2:end]))
+			pos = end + 1
+			continue
+		}
+
+		name := scanName(s[pos+1:])
+		if name == "" {
+			b.WriteByte(ch)
+			pos++
+			continue
+		}
+		if value, ok := e.ref(i, name); ok {
+			b.WriteString(value)
+		} else {
+			e.fail(key, "$"+name+" is not set")
+		}
+		pos += 1 + len(name)
+	}
+	return b.String()
+}
+
+// substitute evaluates the body of a ${...} expression
+func (e *expander) substitute(i int, body string) string {
+	key := e.vars[i].Key
+	name := scanName(body)
+	if name == "" {
+		e.fail(key, fmt.Sprintf("bad substitution ${%s}", body))
+		return ""
+	}
+
+	op := body[len(name):]
+	value, ok := e.ref(i, name)
+	switch {
+	case op == "":
+		if !ok {
+			e.fail(key, "${"+name+"} is not set")
+		}
+		return value
+	case strings.HasPrefix(op, ":-"):
+		if !ok || value == "" {
+			return e.expand(i, op[2:])
+		}
+		return value
+	case strings.HasPrefix(op, "-"):
+		if !ok {
+			return e.expand(i, op[1:])
+		}
+		return value
+	case strings.HasPrefix(op, ":?"):
+		if !ok || value == "" {
+			e.fail(key, requiredMessage(name, e.expand(i, op[2:])))
+		}
+		return value
+	case strings.HasPrefix(op, "?"):
+		if !ok {
+			e.fail(key, requiredMessage(name, e.expand(i, op[1:])))
+		}
+		return value
+	}
+
+	e.fail(key, fmt.Sprintf("bad substitution ${%s}", body))
+	return ""
+}
+
+func requiredMessage(name, msg string) string {
+	if msg == "" {
+		return name + " is required"
+	}
+	return name + ": " + msg
+}
+
+// matchBrace returns the index of the '}' closing a ${ whose body starts at
+// start, accounting for nested ${...} in defaults.
+func matchBrace(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func scanName(s string) string {
+	end := 0
+	for end < len(s) {
+		ch, size := utf8.DecodeRuneInString(s[end:])
+		if !unicode.IsLetter(ch) && ch != '_' && (end == 0 || !unicode.IsDigit(ch)) {
+			break
+		}
+		end += size
+	}
+	return s[:end]
+}
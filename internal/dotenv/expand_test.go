@@ -0,0 +1,92 @@
+package dotenv
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandAll(t *testing.T) {
+	host := map[string]string{"HOME": "/home/me", "PATH": "/usr/bin", "EMPTY": ""}
+	lookup := func(k string) (string, bool) {
+		v, ok := host[k]
+		return v, ok
+	}
+
+	tests := []struct {
+		name string
+		vars []Var
+		want map[string]string
+		errs []string // Substrings of the expected errors, in order
+	}{
+		{
+			name: "references",
+			vars: []Var{{Key: "A", Value: "${HOME}/a"}, {Key: "B", Value: "$A/b"}, {Key: "C", Value: "${B}c"}},
+			want: map[string]string{"A": "/home/me/a", "B": "/home/me/a/b", "C": "/home/me/a/bc"},
+		},
+		{
+			name: "forward reference",
+			vars: []Var{{Key: "URL", Value: "http://$HOST:$PORT"}, {Key: "HOST", Value: "db"}, {Key: "PORT", Value: "5432"}},
+			want: map[string]string{"URL": "http://db:5432", "HOST": "db", "PORT": "5432"},
+		},
+		{
+			name: "self reference sees the previous value",
+			vars: []Var{{Key: "PATH", Value: "${PATH}:/opt/bin"}, {Key: "PATH", Value: "/first:$PATH"}},
+			want: map[string]string{"PATH": "/first:/usr/bin:/opt/bin"},
+		},
+		{
+			name: "defaults",
+			vars: []Var{{Key: "A", Value: "${MISSING:-x}"}, {Key: "B", Value: "${EMPTY:-y}"}, {Key: "C", Value: "${EMPTY-z}"}, {Key: "D", Value: "${MISSING:-${HOME}}"}},
+			want: map[string]string{"A": "x", "B": "y", "C": "", "D": "/home/me"},
+		},
+		{
+			name: "literal and escaped",
+			vars: []Var{{Key: "A", Value: "$HOME", Literal: true}, {Key: "B", Value: `\$HOME`}, {Key: "C", Value: "cost $5 or $"}},
+			want: map[string]string{"A": "$HOME", "B": "$HOME", "C": "cost $5 or $"},
+		},
+		{
+			name: "missing keys",
+			vars: []Var{{Key: "A", Value: "${NOPE}x"}, {Key: "B", Value: "$ALSO_NOPE"}},
+			want: map[string]string{"A": "x", "B": ""},
+			errs: []string{"A: ${NOPE} is not set", "B: $ALSO_NOPE is not set"},
+		},
+		{
+			name: "required",
+			vars: []Var{{Key: "A", Value: "${TOKEN:?set it first}"}, {Key: "B", Value: "${EMPTY:?}"}, {Key: "C", Value: "${EMPTY?}"}},
+			want: map[string]string{"A": "", "B": "", "C": ""},
+			errs: []string{"A: TOKEN: set it first", "B: EMPTY is required"},
+		},
+		{
+			name: "cycle",
+			vars: []Var{{Key: "A", Value: "${B}"}, {Key: "B", Value: "${C}"}, {Key: "C", Value: "$A"}, {Key: "D", Value: "ok"}},
+			want: map[string]string{"A": "", "B": "", "C": "", "D": "ok"},
+			errs: []string{"reference cycle A -> B -> C -> A"},
+		},
+		{
+			name: "bad substitution",
+			vars: []Var{{Key: "A", Value: "${}"}, {Key: "B", Value: "${HOME"}, {Key: "C", Value: "${HOME/x}"}},
+			want: map[string]string{"A": "", "B": "${HOME", "C": ""},
+			errs: []string{"A: bad substitution ${}", "B: unterminated ${", "C: bad substitution ${HOME/x}"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errs := ExpandAll(tt.vars, lookup)
+			for k, want := range tt.want {
+				if got[k] != want {
+					t.Errorf("%s = %q, want %q", k, got[k], want)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("ExpandAll() = %v, want %v", got, tt.want)
+			}
+			if len(errs) != len(tt.errs) {
+				t.Fatalf("errors = %v, want %d matching %q", errs, len(tt.errs), tt.errs)
+			}
+			for i, err := range errs {
+				if _, ok := err.(*ExpandError); !ok || !strings.Contains(err.Error(), tt.errs[i]) {
+					t.Errorf("error %d = %v, want one containing %q", i, err, tt.errs[i])
+				}
+			}
+		})
+	}
+}
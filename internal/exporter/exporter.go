@@ -0,0 +1,92 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/MasFana/fana-envy/internal/dotenv"
+)
+
+// Formats lists every supported output format
+var Formats = []string{"bash", "zsh", "fish", "powershell", "docker", "systemd", "json", "dotenv"}
+
+// Export serializes vars, sorted by key, in the given format
+func Export(vars map[string]string, format string) (string, error) {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if format == "json" {
+		data, err := json.MarshalIndent(vars, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	}
+
+	var line func(k, v string) (string, error)
+	switch format {
+	case "bash", "zsh", "sh":
+		line = func(k, v string) (string, error) {
+			return "export " + k + "=" + posixQuote(v), nil
+		}
+	case "fish":
+		line = func(k, v string) (string, error) {
+			return "set -gx " + k + " " + fishQuote(v), nil
+		}
+	case "powershell", "pwsh":
+		line = func(k, v string) (string, error) {
+			return "$env:" + k + " = '" + strings.ReplaceAll(v, "'", "''") + "'", nil
+		}
+	case "docker":
+		line = func(k, v string) (string, error) {
+			// Docker reads everything after '=' verbatim, one variable per line
+			if strings.ContainsAny(v, "\r\n") {
+				return "", fmt.Errorf("%s: docker env files cannot hold multiline values", k)
+			}
+			return k + "=" + v, nil
+		}
+	case "systemd":
+		line = func(k, v string) (string, error) {
+			return k + "=" + systemdQuote(v), nil
+		}
+	case "dotenv":
+		line = func(k, v string) (string, error) {
+			return k + "=" + dotenv.QuoteLiteral(v), nil
+		}
+	default:
+		return "", fmt.Errorf("unknown format %q (use %s)", format, strings.Join(Formats, ", "))
+	}
+
+	var b strings.Builder
+	for _, k := range keys {
+		l, err := line(k, vars[k])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(l + "\n")
+	}
+	return b.String(), nil
+}
+
+// posixQuote single quotes v for sh, bash and zsh
+func posixQuote(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
+}
+
+// fishQuote single quotes v; fish only treats \\ and \' as escapes there
+func fishQuote(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	return "'" + strings.ReplaceAll(v, "'", `\'`) + "'"
+}
+
+// systemdQuote double quotes v for an EnvironmentFile. Quoted values may
+// span lines; backslash and double quote are escaped.
+func systemdQuote(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	return `"` + strings.ReplaceAll(v, `"`, `\"`) + `"`
+}
@@ -0,0 +1,135 @@
+package exporter
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/MasFana/fana-envy/internal/dotenv"
+)
+
+var tricky = map[string]string{
+	"PLAIN":  "value",
+	"SPACES": "two words",
+	"SINGLE": "it's",
+	"DOUBLE": `say "hi"`,
+	"DOLLAR": "$HOME and `cmd`",
+	"SLASH":  `C:\path\'x`,
+	"LINES":  "one\ntwo",
+	"PRICE":  "it's $5",
+}
+
+func TestExport(t *testing.T) {
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"bash", []string{
+			`export DOLLAR='$HOME and ` + "`cmd`'",
+			`export DOUBLE='say "hi"'`,
+			"export LINES='one\ntwo'",
+			`export PLAIN='value'`,
+			`export SINGLE='it'\''s'`,
+			`export SLASH='C:\path\'\''x'`,
+			`export SPACES='two words'`,
+		}},
+		{"fish", []string{
+			`set -gx DOLLAR '$HOME and ` + "`cmd`'",
+			`set -gx SINGLE 'it\'s'`,
+			`set -gx SLASH 'C:\\path\\\'x'`,
+		}},
+		{"powershell", []string{
+			`$env:DOLLAR = '$HOME and ` + "`cmd`'",
+			`$env:SINGLE = 'it''s'`,
+			`$env:SLASH = 'C:\path\''x'`,
+		}},
+		{"systemd", []string{
+			`DOUBLE="say \"hi\""`,
+			`SINGLE="it's"`,
+			`SLASH="C:\\path\\'x"`,
+			"LINES=\"one\ntwo\"",
+		}},
+		{"dotenv", []string{
+			`DOLLAR='$HOME and ` + "`cmd`'",
+			`DOUBLE="say \"hi\""`,
+			`PRICE="it's \\$5"`,
+			`PLAIN=value`,
+			`SLASH="C:\\path\\'x"`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			out, err := Export(tricky, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want+"\n") {
+					t.Errorf("output lacks %s\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	if _, err := Export(map[string]string{"A": "one\ntwo"}, "docker"); err == nil {
+		t.Error("docker export of a multiline value succeeded")
+	}
+	if out, err := Export(map[string]string{"A": `x "y" $z`}, "docker"); err != nil || out != "A=x \"y\" $z\n" {
+		t.Errorf("docker export = %q, %v", out, err)
+	}
+	if _, err := Export(tricky, "csv"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+// TestExportDotenvReloads reads the dotenv output back the way profiles
+// are loaded, so '$' must not be interpolated again.
+func TestExportDotenvReloads(t *testing.T) {
+	out, err := Export(tricky, "dotenv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := dotenv.Parse(out)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", out, err)
+	}
+	got, errs := dotenv.ExpandAll(dotenv.VarsOf(doc), nil)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	for k, want := range tricky {
+		if got[k] != want {
+			t.Errorf("%s = %q, want %q", k, got[k], want)
+		}
+	}
+}
+
+// TestExportRunsInShell evaluates the output in the shells found on PATH
+// and checks every value comes back unchanged.
+func TestExportRunsInShell(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		t.Run(shell, func(t *testing.T) {
+			if _, err := exec.LookPath(shell); err != nil {
+				t.Skipf("%s not found", shell)
+			}
+			out, err := Export(tricky, shell)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, want := range tricky {
+				cmd := exec.Command(shell, "-c", out+`printf '%s\0' "$`+k+`"`)
+				cmd.Env = append(os.Environ(), "HOME=/nowhere")
+				got, err := cmd.Output()
+				if err != nil {
+					t.Fatalf("%s: %v", shell, err)
+				}
+				if string(got) != want+"\x00" {
+					t.Errorf("%s in %s = %q, want %q", k, shell, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/MasFana/fana-envy/internal/dotenv"
+	"github.com/MasFana/fana-envy/internal/profile"
+	"github.com/MasFana/fana-envy/internal/utils"
+)
+
+// EnvSource is the source name that imports the current process environment
+const EnvSource = "@env"
+
+const Usage = "import [--format F] [--service S] [--include GLOB] [--exclude GLOB] [--overwrite] <file|@env> [profile]"
+
+type Options struct {
+	Format    string
+	Service   string
+	Include   []string
+	Exclude   []string
+	Overwrite bool
+}
+
+// Result reports what an import did to the target profile
+type Result struct {
+	Added     []string `json:"added"`
+	Changed   []string `json:"changed"`
+	Conflicts []string `json:"conflicts"` // Differing keys left alone without --overwrite
+	Unchanged []string `json:"unchanged"`
+	Created   bool     `json:"created"`
+}
+
+// GlobList is a flag value collecting comma separated or repeated key globs
+type GlobList []string
+
+func (g *GlobList) String() string { return strings.Join(*g, ",") }
+
+func (g *GlobList) Set(v string) error {
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("bad pattern %q", p)
+			}
+			*g = append(*g, p)
+		}
+	}
+	return nil
+}
+
+// Register adds the import flags to fs so the TUI command and the CLI
+// accept the same options.
+func (o *Options) Register(fs *flag.FlagSet) {
+	fs.StringVar(&o.Format, "format", "", "source format (default: from the file name)")
+	fs.StringVar(&o.Service, "service", "", "docker-compose service to read")
+	fs.Var((*GlobList)(&o.Include), "include", "only import keys matching GLOB (repeatable)")
+	fs.Var((*GlobList)(&o.Exclude), "exclude", "skip keys matching GLOB (repeatable)")
+	fs.BoolVar(&o.Overwrite, "overwrite", false, "replace differing values")
+}
+
+// Load reads variables from a file, or the process environment for
+// EnvSource, and applies the include/exclude filters. Only values read from
+// .env files keep their ${VAR} references; everything else is literal.
+func Load(source string, opts Options) ([]dotenv.Var, error) {
+	var vars map[string]string
+	var literal map[string]bool
+	var err error
+	if source == EnvSource {
+		vars = make(map[string]string)
+		for _, kv := range os.Environ() {
+			if k, v, ok := strings.Cut(kv, "="); ok && k != "" {
+				vars[k] = v
+			}
+		}
+	} else {
+		vars, literal, err = loadFile(source, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var filtered []dotenv.Var
+	for k, v := range vars {
+		if !utils.IsValidEnvVar(k) {
+			continue
+		}
+		if len(opts.Include) > 0 && !matchAny(opts.Include, k) {
+			continue
+		}
+		if matchAny(opts.Exclude, k) {
+			continue
+		}
+		filtered = append(filtered, dotenv.Var{Key: k, Value: v, Literal: literal == nil || literal[k]})
+	}
+	sort.Slice(filtered, func(i, j int) bool { return filtered[i].Key < filtered[j].Key })
+	return filtered, nil
+}
+
+func matchAny(globs []string, key string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func detectFormat(file string) string {
+	base := strings.ToLower(filepath.Base(file))
+	switch {
+	case strings.Contains(base, "compose") && (strings.HasSuffix(base, ".yml") || strings.HasSuffix(base, ".yaml")):
+		return "compose"
+	case strings.HasSuffix(base, ".json"):
+		return "json"
+	case strings.HasSuffix(base, ".yml"), strings.HasSuffix(base, ".yaml"):
+		return "yaml"
+	}
+	return "dotenv"
+}
+
+// loadFile returns the variables of a file and, for .env files, which of
+// them were single quoted. A nil literal map means every value is literal.
+func loadFile(file string, opts Options) (map[string]string, map[string]bool, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = detectFormat(file)
+	}
+
+	switch format {
+	case "dotenv", "env":
+		doc, err := dotenv.Parse(string(content))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", file, err)
+		}
+		vars := make(map[string]string)
+		literal := make(map[string]bool)
+		for _, v := range dotenv.VarsOf(doc) {
+			vars[v.Key] = v.Value
+			literal[v.Key] = v.Literal
+		}
+		return vars, literal, nil
+
+	case "json":
+		// Numbers are kept as written so 10000000 does not become 1e+07
+		var obj map[string]any
+		dec := json.NewDecoder(bytes.NewReader(content))
+		dec.UseNumber()
+		err := dec.Decode(&obj)
+		if err == nil && dec.More() {
+			err = errors.New("unexpected data after the object")
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: expected a JSON object: %w", file, err)
+		}
+		vars, err := flatten(obj)
+		return vars, nil, err
+
+	case "yaml", "compose":
+		data, err := parseYAML(string(content))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", file, err)
+		}
+		obj, ok := data.(map[string]any)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: expected a YAML mapping", file)
+		}
+		var vars map[string]string
+		if _, isCompose := obj["services"]; format == "compose" || isCompose {
+			vars, err = composeEnvironment(obj, opts.Service)
+		} else {
+			vars, err = flatten(obj)
+		}
+		return vars, nil, err
+	}
+	return nil, nil, fmt.Errorf("unknown format %q", format)
+}
+
+// flatten turns a decoded object into variables. Scalars become strings;
+// nested values are kept as compact JSON.
+func flatten(obj map[string]any) (map[string]string, error) {
+	vars := make(map[string]string)
+	for k, v := range obj {
+		switch v := v.(type) {
+		case string:
+			vars[k] = v
+		case nil:
+			vars[k] = ""
+		case json.Number:
+			vars[k] = v.String()
+		case bool:
+			vars[k] = fmt.Sprint(v)
+		default:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			vars[k] = string(data)
+		}
+	}
+	return vars, nil
+}
+
+// composeEnvironment extracts the `environment:` block of one
+// docker-compose service, in either list or mapping form.
+func composeEnvironment(obj map[string]any, service string) (map[string]string, error) {
+	services, _ := obj["services"].(map[string]any)
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no services found")
+	}
+
+	if service == "" {
+		var withEnv []string
+		for name, svc := range services {
+			if s, ok := svc.(map[string]any); ok && s["environment"] != nil {
+				withEnv = append(withEnv, name)
+			}
+		}
+		sort.Strings(withEnv)
+		if len(withEnv) != 1 {
+			return nil, fmt.Errorf("choose a service with --service (%s)", strings.Join(withEnv, ", "))
+		}
+		service = withEnv[0]
+	}
+
+	svc, ok := services[service].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("service %q not found", service)
+	}
+
+	vars := make(map[string]string)
+	switch env := svc["environment"].(type) {
+	case map[string]any:
+		return flatten(env)
+	case []any:
+		for _, item := range env {
+			s, _ := item.(string)
+			// A bare KEY passes the value through from the shell; skip it
+			if k, v, ok := strings.Cut(s, "="); ok {
+				vars[k] = v
+			}
+		}
+	}
+	return vars, nil
+}
+
+// Merge writes vars into a profile, creating it if needed. Existing keys
+// with a different value are only replaced when overwrite is set.
+func Merge(envDir, name string, vars []dotenv.Var, overwrite bool) (Result, error) {
+	res := Result{Added: []string{}, Changed: []string{}, Conflicts: []string{}, Unchanged: []string{}}
+	if !profile.Exists(envDir, name) {
+		if err := profile.Create(envDir, name); err != nil {
+			return res, err
+		}
+		res.Created = true
+	}
+
+	err := profile.Update(envDir, name, "import", func(doc *dotenv.Document) error {
+		for _, v := range vars {
+			current, exists := doc.Get(v.Key)
+			switch {
+			case !exists:
+				res.Added = append(res.Added, v.Key)
+			case current == v.Value:
+				res.Unchanged = append(res.Unchanged, v.Key)
+				continue
+			case !overwrite:
+				res.Conflicts = append(res.Conflicts, v.Key)
+				continue
+			default:
+				res.Changed = append(res.Changed, v.Key)
+			}
+			if v.Literal {
+				doc.SetLiteral(v.Key, v.Value)
+			} else {
+				doc.Set(v.Key, v.Value)
+			}
+		}
+		return nil
+	})
+	return res, err
+}
@@ -0,0 +1,66 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want map[string]string
+		err  bool
+	}{
+		{
+			name: "large integers",
+			src:  `{"PORT_MAX": 10000000, "ID": 9007199254740993, "NEG": -12345678901234567890}`,
+			want: map[string]string{"PORT_MAX": "10000000", "ID": "9007199254740993", "NEG": "-12345678901234567890"},
+		},
+		{
+			name: "numbers as written",
+			src:  `{"RATIO": 1.50, "EXP": 1e3, "ZERO": 0}`,
+			want: map[string]string{"RATIO": "1.50", "EXP": "1e3", "ZERO": "0"},
+		},
+		{
+			name: "other scalars",
+			src:  `{"S": "text", "B": true, "N": null}`,
+			want: map[string]string{"S": "text", "B": "true", "N": ""},
+		},
+		{
+			name: "nested",
+			src:  `{"DB": {"port": 10000000, "hosts": ["a", "b"]}}`,
+			want: map[string]string{"DB": `{"hosts":["a","b"],"port":10000000}`},
+		},
+		{name: "not an object", src: `[1, 2]`, err: true},
+		{name: "trailing data", src: `{"A": 1} {"B": 2}`, err: true},
+		{name: "invalid", src: `{"A": }`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "vars.json")
+			if err := os.WriteFile(path, []byte(tt.src), 0644); err != nil {
+				t.Fatal(err)
+			}
+			vars, err := Load(path, Options{})
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Load() = %v, want an error", vars)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for _, v := range vars {
+				got[v.Key] = v.Value
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package importer
+
+import (
+	"fmt"
+	"maps"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAML decodes the first document of src into maps, slices and
+// strings. Scalars are kept as written, so `1.10` or `0755` are not turned
+// into numbers, since every value ends up in an environment variable
+// anyway; null becomes "". Anchors, aliases and `<<` merge keys are
+// resolved.
+func parseYAML(src string) (any, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return map[string]any{}, nil
+	}
+	return yamlValue(doc.Content[0])
+}
+
+func yamlValue(n *yaml.Node) (any, error) {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return yamlValue(n.Alias)
+
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return "", nil
+		}
+		return n.Value, nil
+
+	case yaml.SequenceNode:
+		items := make([]any, 0, len(n.Content))
+		for _, c := range n.Content {
+			v, err := yamlValue(c)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+
+	case yaml.MappingNode:
+		// Merged mappings go first so the node's own keys win, and of
+		// several merged ones the first wins
+		var merged []*yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if k, v := n.Content[i], n.Content[i+1]; k.Tag == "!!merge" {
+				if v.Kind == yaml.SequenceNode {
+					merged = append(merged, v.Content...)
+				} else {
+					merged = append(merged, v)
+				}
+			}
+		}
+		m := make(map[string]any)
+		for i := len(merged) - 1; i >= 0; i-- {
+			v, err := yamlValue(merged[i])
+			if err != nil {
+				return nil, err
+			}
+			src, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("line %d: only mappings can be merged", merged[i].Line)
+			}
+			maps.Copy(m, src)
+		}
+
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			if k.Tag == "!!merge" {
+				continue
+			}
+			if k.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: keys must be plain values", k.Line)
+			}
+			val, err := yamlValue(v)
+			if err != nil {
+				return nil, err
+			}
+			m[k.Value] = val
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("line %d: unsupported YAML", n.Line)
+}
@@ -0,0 +1,117 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want any
+	}{
+		{"empty", "# nothing\n", map[string]any{}},
+		{"scalars as written", "PORT: 08080\nVERSION: 1.10\nDEBUG: yes\nEMPTY:\nNONE: ~\n", map[string]any{
+			"PORT": "08080", "VERSION": "1.10", "DEBUG": "yes", "EMPTY": "", "NONE": "",
+		}},
+		{"quoted", "A: \"x # not a comment\\n\"\nB: 'it''s'\n\"C D\": v # comment\n", map[string]any{
+			"A": "x # not a comment\n", "B": "it's", "C D": "v",
+		}},
+		{"block scalars", "KEY: |\n  line 1\n  line 2\nTEXT: >-\n  folded\n  text\n", map[string]any{
+			"KEY": "line 1\nline 2\n", "TEXT": "folded text",
+		}},
+		{"nested", "db:\n  host: localhost\n  ports:\n  - 5432\n  - 5433\n", map[string]any{
+			"db": map[string]any{"host": "localhost", "ports": []any{"5432", "5433"}},
+		}},
+		{"flow", "HOSTS: [a, 'b c']\nOPTS: {k: v, n: 1}\n", map[string]any{
+			"HOSTS": []any{"a", "b c"}, "OPTS": map[string]any{"k": "v", "n": "1"},
+		}},
+		{"anchors and merge keys", "base: &base\n  A: 1\n  B: 2\napp:\n  <<: *base\n  B: 3\n  C: *base\n", map[string]any{
+			"base": map[string]any{"A": "1", "B": "2"},
+			"app":  map[string]any{"A": "1", "B": "3", "C": map[string]any{"A": "1", "B": "2"}},
+		}},
+		{"several merged", "a: &a {X: 1}\nb: &b {X: 2, Y: 2}\nc:\n  <<: [*a, *b]\n", map[string]any{
+			"a": map[string]any{"X": "1"}, "b": map[string]any{"X": "2", "Y": "2"}, "c": map[string]any{"X": "1", "Y": "2"},
+		}},
+		{"first document only", "A: 1\n---\nA: 2\n", map[string]any{"A": "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML(tt.src)
+			if err != nil {
+				t.Fatalf("parseYAML(%q): %v", tt.src, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseYAML(%q) = %#v, want %#v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"tab indentation", "db:\n\thost: x\n"},
+		{"bad indentation", "a: 1\n  b: 2\n"},
+		{"unterminated quote", "A: \"open\n"},
+		{"unclosed flow", "A: [a, b\n"},
+		{"unknown alias", "A: *missing\n"},
+		{"merge of a scalar", "a: &a 1\nb:\n  <<: *a\n"},
+		{"mapping key", "? [a, b]\n: v\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v, err := parseYAML(tt.src); err == nil {
+				t.Errorf("parseYAML(%q) = %#v, want an error", tt.src, v)
+			}
+		})
+	}
+}
+
+func TestLoadYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		src  string
+		opts Options
+		want map[string]string
+		err  bool
+	}{
+		{"map", "settings.yaml", "PORT: 8080\nDB:\n  host: x\n", Options{}, map[string]string{"PORT": "8080", "DB": `{"host":"x"}`}, false},
+		{"compose list", "docker-compose.yml", "services:\n  api:\n    environment:\n      - A=1\n      - PASSTHROUGH\n", Options{}, map[string]string{"A": "1"}, false},
+		{"compose map", "compose.yaml", "services:\n  api:\n    environment: {A: '1', B: x=y}\n  db:\n    image: pg\n", Options{}, map[string]string{"A": "1", "B": "x=y"}, false},
+		{"compose service", "compose.yml", "services:\n  a:\n    environment: [A=1]\n  b:\n    environment: [B=2]\n", Options{Service: "b"}, map[string]string{"B": "2"}, false},
+		{"ambiguous service", "compose.yml", "services:\n  a:\n    environment: [A=1]\n  b:\n    environment: [B=2]\n", Options{}, nil, true},
+		{"not a mapping", "list.yaml", "- a\n- b\n", Options{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.src), 0644); err != nil {
+				t.Fatal(err)
+			}
+			vars, err := Load(path, tt.opts)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Load() = %v, want an error", vars)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for _, v := range vars {
+				got[v.Key] = v.Value
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+// Package merge moves keys between profiles. Values are copied as written
+// in the source file, so ${VAR} references and encrypted values survive,
+// and the target keeps its comments and layout.
+package merge
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/MasFana/fana-envy/internal/dotenv"
+	"github.com/MasFana/fana-envy/internal/profile"
+)
+
+const (
+	MergeUsage    = "merge [--base B] [--include GLOB] [--ours|--theirs] <from> <into>"
+	CopyKeysUsage = "copy-keys [--ours|--theirs] <from> <into> GLOB..."
+)
+
+// Resolution decides a conflict
+type Resolution int
+
+const (
+	Unresolved Resolution = iota
+	KeepMine              // Leave the target as it is
+	TakeTheirs            // Use the source value, or delete when the source dropped the key
+	Edited                // Use Conflict.Value
+)
+
+// Conflict is a key both sides changed differently. Mine is the target,
+// theirs the source.
+type Conflict struct {
+	Key    string
+	Mine   *dotenv.Var // nil when the target does not have the key
+	Theirs *dotenv.Var // nil when the source deleted the key
+	Base   *dotenv.Var
+	Choice Resolution
+	Value  string // Value written for Edited
+}
+
+// Plan is what a merge will do to the target profile
+type Plan struct {
+	From, Into, Base string
+
+	Set       []dotenv.Var // Keys taken from the source without conflict
+	Delete    []string     // Keys the source deleted since the base
+	Conflicts []*Conflict
+	Unchanged int
+}
+
+// Unresolved counts the conflicts still waiting for a decision
+func (p *Plan) Unresolved() int {
+	n := 0
+	for _, c := range p.Conflicts {
+		if c.Choice == Unresolved {
+			n++
+		}
+	}
+	return n
+}
+
+// Resolve decides every open conflict the same way
+func (p *Plan) Resolve(choice Resolution) {
+	for _, c := range p.Conflicts {
+		if c.Choice == Unresolved {
+			c.Choice = choice
+		}
+	}
+}
+
+func ownVars(envDir, name string) (map[string]dotenv.Var, error) {
+	doc, err := profile.Read(envDir, name)
+	if os.IsNotExist(err) {
+		err = profile.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	vars := make(map[string]dotenv.Var)
+	for _, v := range dotenv.VarsOf(doc) {
+		vars[v.Key] = v
+	}
+	return vars, nil
+}
+
+func matches(globs []string, key string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	for _, g := range globs {
+		if ok, _ := path.Match(g, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// New plans merging the keys of from that match globs (all keys when
+// there are none) into into. Only the keys written in each file count,
+// not inherited ones.
+//
+// Without a base every key that exists on both sides with different
+// values is a conflict. With a base profile, the common ancestor, a key
+// changed on one side only takes that side's value, including deletions,
+// and only keys changed on both sides conflict.
+func New(envDir, from, into, base string, globs []string) (*Plan, error) {
+	for _, g := range globs {
+		if _, err := path.Match(g, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q", g)
+		}
+	}
+	theirs, err := ownVars(envDir, from)
+	if err != nil {
+		return nil, err
+	}
+	mine, err := ownVars(envDir, into)
+	if err != nil {
+		return nil, err
+	}
+	var ancestor map[string]dotenv.Var
+	if base != "" {
+		if ancestor, err = ownVars(envDir, base); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make(map[string]bool)
+	for k := range theirs {
+		keys[k] = true
+	}
+	// Deletions on the source side only show up against a base
+	for k := range ancestor {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		if matches(globs, k) {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Strings(sorted)
+
+	p := &Plan{From: from, Into: into, Base: base}
+	for _, k := range sorted {
+		t, hasT := theirs[k]
+		mv, hasM := mine[k]
+		b, hasB := ancestor[k]
+
+		same := func(x dotenv.Var, hx bool, y dotenv.Var, hy bool) bool {
+			return hx == hy && (!hx || x.Value == y.Value)
+		}
+		switch {
+		case same(t, hasT, mv, hasM):
+			p.Unchanged++
+		case base != "" && same(t, hasT, b, hasB):
+			// Only mine changed since the base
+			p.Unchanged++
+		case !hasM && base == "", base != "" && same(mv, hasM, b, hasB):
+			// Only theirs changed, or the key is new
+			if hasT {
+				p.Set = append(p.Set, t)
+			} else {
+				p.Delete = append(p.Delete, k)
+			}
+		default:
+			c := &Conflict{Key: k}
+			if hasM {
+				c.Mine = &mv
+			}
+			if hasT {
+				c.Theirs = &t
+			}
+			if hasB {
+				c.Base = &b
+			}
+			p.Conflicts = append(p.Conflicts, c)
+		}
+	}
+	return p, nil
+}
+
+// Apply writes the plan to the target profile. Conflicts must all be
+// resolved.
+func Apply(envDir string, p *Plan) error {
+	if n := p.Unresolved(); n > 0 {
+		return fmt.Errorf("%d unresolved conflicts", n)
+	}
+	return profile.Update(envDir, p.Into, "merge", func(doc *dotenv.Document) error {
+		for _, v := range p.Set {
+			set(doc, v)
+		}
+		for _, k := range p.Delete {
+			doc.Unset(k)
+		}
+		for _, c := range p.Conflicts {
+			switch c.Choice {
+			case TakeTheirs:
+				if c.Theirs != nil {
+					set(doc, *c.Theirs)
+				} else {
+					doc.Unset(c.Key)
+				}
+			case Edited:
+				doc.Set(c.Key, c.Value)
+			}
+		}
+		return nil
+	})
+}
+
+func set(doc *dotenv.Document, v dotenv.Var) {
+	if v.Literal {
+		doc.SetLiteral(v.Key, v.Value)
+	} else {
+		doc.Set(v.Key, v.Value)
+	}
+	profile.RemoveDirectiveArg(doc, "unset", v.Key)
+}
@@ -0,0 +1,106 @@
+package profile
+
+import (
+	"os"
+	"path"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// DefaultAllow lists the host variables an isolated profile still passes
+// to children, so tools can be found and behave normally. `# @allow`
+// adds more names or glob patterns.
+var DefaultAllow = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "COLORTERM",
+	"LANG", "LC_*", "TZ", "TMPDIR",
+	// Windows needs these to start most programs
+	"SystemRoot", "SystemDrive", "windir", "ComSpec", "PATHEXT",
+	"TEMP", "TMP", "USERPROFILE", "APPDATA", "LOCALAPPDATA",
+	"ProgramData", "ProgramFiles", "ProgramFiles(x86)", "NUMBER_OF_PROCESSORS",
+}
+
+// Allowed reports whether an isolated env passes the host variable key
+func (e *Env) Allowed(key string) bool {
+	for _, list := range [][]string{DefaultAllow, e.Allow} {
+		for _, pattern := range list {
+			// Windows variable names are case insensitive
+			if runtime.GOOS == "windows" {
+				pattern, key = strings.ToUpper(pattern), strings.ToUpper(key)
+			}
+			if ok, _ := path.Match(pattern, key); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// envKey is the identity of a variable name; Windows ignores case
+func envKey(k string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToUpper(k)
+	}
+	return k
+}
+
+type environ struct {
+	keys   []string // First spelling of each key, in insertion order
+	values map[string]string
+}
+
+func (e *environ) set(k, v string) {
+	id := envKey(k)
+	if _, ok := e.values[id]; !ok {
+		e.keys = append(e.keys, k)
+	}
+	e.values[id] = v
+}
+
+func (e *environ) del(k string) {
+	id := envKey(k)
+	if _, ok := e.values[id]; !ok {
+		return
+	}
+	delete(e.values, id)
+	e.keys = slices.DeleteFunc(e.keys, func(s string) bool { return envKey(s) == id })
+}
+
+// BuildEnv returns the environment for a child process with one entry per
+// key, sorted. Later layers win:
+//
+//  1. the host environment (only allowed keys when the profile is isolated)
+//  2. defaults injected by the caller
+//  3. the profile, after the profiles it extends
+//  4. per-command overrides
+//
+// Keys named by `# @unset` are removed from layers 1 and 2.
+func BuildEnv(env *Env, defaults, overrides map[string]string) []string {
+	e := &environ{values: make(map[string]string)}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		if !env.Isolated || env.Allowed(k) {
+			e.set(k, v)
+		}
+	}
+	for k, v := range defaults {
+		e.set(k, v)
+	}
+	for _, k := range env.Unset {
+		e.del(k)
+	}
+	for k, v := range env.Vars {
+		e.set(k, v)
+	}
+	for k, v := range overrides {
+		e.set(k, v)
+	}
+
+	sort.Slice(e.keys, func(i, j int) bool { return e.keys[i] < e.keys[j] })
+	out := make([]string, 0, len(e.keys))
+	for _, k := range e.keys {
+		out = append(out, k+"="+e.values[envKey(k)])
+	}
+	return out
+}
@@ -0,0 +1,215 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MasFana/fana-envy/internal/config"
+	"github.com/MasFana/fana-envy/internal/storage"
+)
+
+// HistoryDir holds a folder of revisions per profile, named
+// <time>-<source>.env so they sort by age.
+const HistoryDir = ".history"
+
+const HistoryUsage = "history [list] [profile] | history diff|restore [profile] <n> | undo [profile]"
+
+const revisionTime = "20060102T150405.000000000"
+
+var ErrNoRevision = errors.New("no such revision")
+
+// Revision is one saved version of a profile. N counts from 1, the
+// newest.
+type Revision struct {
+	N      int       `json:"n"`
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"` // What wrote it: editor, set, unset, import, ...
+	Path   string    `json:"path"`
+}
+
+func historyPath(envDir, name string) string {
+	return filepath.Join(envDir, HistoryDir, name)
+}
+
+// Write replaces a profile's content and records it as a revision. The
+// content it replaces is recorded first when the history does not have it
+// yet, as "original" or, after an edit outside Fana-Envy, "external".
+func Write(envDir, name, content, source string) error {
+	return storage.Locked(envDir, func() error {
+		return write(envDir, name, content, source)
+	})
+}
+
+// write is Write for callers already holding the lock
+func write(envDir, name, content, source string) error {
+	revs, err := Revisions(envDir, name)
+	if err != nil {
+		return err
+	}
+	if old, err := os.ReadFile(Path(envDir, name)); err == nil {
+		prev := "external"
+		if len(revs) == 0 {
+			prev = "original"
+		}
+		if err := record(envDir, name, string(old), prev); err != nil {
+			return err
+		}
+	}
+
+	if err := storage.WriteFile(Path(envDir, name), []byte(content), 0644); err != nil {
+		return err
+	}
+	remember(Path(envDir, name))
+	if err := record(envDir, name, content, source); err != nil {
+		return fmt.Errorf("saved, but not added to history: %w", err)
+	}
+	return prune(envDir, name)
+}
+
+func record(envDir, name, content, source string) error {
+	// Saving without changes adds nothing. Undo always counts, as Undo
+	// finds how far back to go from the undos in a row.
+	if revs, _ := Revisions(envDir, name); len(revs) > 0 && source != "undo" {
+		if last, err := os.ReadFile(revs[0].Path); err == nil && string(last) == content {
+			return nil
+		}
+	}
+	dir := historyPath(envDir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file := time.Now().UTC().Format(revisionTime) + "-" + source + ".env"
+	return storage.WriteFile(filepath.Join(dir, file), []byte(content), 0644)
+}
+
+// Revisions lists the saved versions of a profile, newest first. History
+// is kept after a profile is deleted so it can be restored.
+func Revisions(envDir, name string) ([]Revision, error) {
+	dir := historyPath(envDir, name)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var revs []Revision
+	for _, e := range entries {
+		base, ok := strings.CutSuffix(e.Name(), ".env")
+		if e.IsDir() || !ok {
+			continue
+		}
+		stamp, source, _ := strings.Cut(base, "-")
+		t, err := time.Parse(revisionTime, stamp)
+		if err != nil {
+			continue
+		}
+		revs = append(revs, Revision{Time: t, Source: source, Path: filepath.Join(dir, e.Name())})
+	}
+	sort.Slice(revs, func(i, j int) bool { return revs[i].Time.After(revs[j].Time) })
+	for i := range revs {
+		revs[i].N = i + 1
+	}
+	return revs, nil
+}
+
+// GetRevision returns revision n of a profile, 1 being the newest
+func GetRevision(envDir, name string, n int) (Revision, error) {
+	revs, err := Revisions(envDir, name)
+	if err != nil {
+		return Revision{}, err
+	}
+	if n < 1 || n > len(revs) {
+		return Revision{}, fmt.Errorf("%s: %w %d (%d saved)", name, ErrNoRevision, n, len(revs))
+	}
+	return revs[n-1], nil
+}
+
+// Restore writes revision n back as the current content, recreating a
+// deleted profile. Restoring is recorded like any other write.
+func Restore(envDir, name string, n int) error {
+	return storage.Locked(envDir, func() error {
+		rev, err := GetRevision(envDir, name, n)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(rev.Path)
+		if err != nil {
+			return err
+		}
+		return write(envDir, name, string(content), "restore")
+	})
+}
+
+// Undo restores the version before the last write and returns its
+// revision number. Undos in a row keep going back: each one skips the
+// versions the undos before it went through.
+func Undo(envDir, name string) (int, error) {
+	n := 0
+	err := storage.Locked(envDir, func() error {
+		// An edit made outside Fana-Envy is the version to step back from
+		if old, err := os.ReadFile(Path(envDir, name)); err == nil {
+			if err := record(envDir, name, string(old), "external"); err != nil {
+				return err
+			}
+		}
+		revs, err := Revisions(envDir, name)
+		if err != nil {
+			return err
+		}
+		undone := 0
+		for undone < len(revs) && revs[undone].Source == "undo" {
+			undone++
+		}
+		// Each undo added a revision and went back one more
+		n = 2*undone + 2
+		if n > len(revs) {
+			return fmt.Errorf("%s: nothing left to undo", name)
+		}
+		content, err := os.ReadFile(revs[n-1].Path)
+		if err != nil {
+			return err
+		}
+		return write(envDir, name, string(content), "undo")
+	})
+	return n, err
+}
+
+// prune drops revisions beyond the configured count and age. The newest
+// revision is always kept.
+func prune(envDir, name string) error {
+	cfg := config.LoadConfig(envDir)
+	keep, maxAge := cfg.HistoryLimit(), cfg.HistoryMaxAge()
+
+	revs, err := Revisions(envDir, name)
+	if err != nil || len(revs) < 2 {
+		return err
+	}
+	for _, rev := range revs[1:] {
+		if rev.N > keep || (maxAge > 0 && time.Since(rev.Time) > maxAge) {
+			if err := os.Remove(rev.Path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// moveHistory keeps the revisions of a renamed profile. The history of
+// a deleted profile with the new name is left alone.
+func moveHistory(envDir, oldName, newName string) error {
+	if _, err := os.Stat(historyPath(envDir, newName)); err == nil {
+		return nil
+	}
+	err := os.Rename(historyPath(envDir, oldName), historyPath(envDir, newName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+package profile
+
+import "testing"
+
+func TestUndoInARow(t *testing.T) {
+	dir := t.TempDir()
+	if err := Create(dir, "dev"); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"1", "2", "3"} {
+		if err := Set(dir, "dev", "A", v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	value := func(key string) string {
+		return Resolve(dir, "dev", noHost).Vars[key]
+	}
+
+	for _, want := range []string{"2", "1", ""} {
+		if _, err := Undo(dir, "dev"); err != nil {
+			t.Fatalf("undo to %q: %v", want, err)
+		}
+		if got := value("A"); got != want {
+			t.Errorf("A after undo = %q, want %q", got, want)
+		}
+	}
+	if _, err := Undo(dir, "dev"); err == nil {
+		t.Errorf("undo past the first version gave A = %q, want an error", value("A"))
+	}
+
+	// A write ends the run: undo goes back to before it
+	if err := Set(dir, "dev", "B", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Undo(dir, "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if got := value("B"); got != "" {
+		t.Errorf("B after undoing it = %q, want it gone", got)
+	}
+}
@@ -0,0 +1,177 @@
+package profile
+
+import (
+	"path"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/MasFana/fana-envy/internal/dotenv"
+	"github.com/MasFana/fana-envy/internal/vault"
+	"github.com/mattn/go-runewidth"
+)
+
+// DefaultSecretPatterns are key globs treated as secret without a
+// `# @secret` annotation. Matching ignores case.
+var DefaultSecretPatterns = []string{"*_TOKEN", "*_KEY", "*PASSWORD*", "*SECRET*"}
+
+// Masked replaces a secret value on screen. It has a fixed length so the
+// length of the value is not revealed either.
+const Masked = "••••••••"
+
+// minMaskLen keeps values like "1" or "on" from being masked all over the
+// screen; values that short are not worth hiding anyway.
+const minMaskLen = 3
+
+// IsSecret reports whether key is annotated with `# @secret`, was stored
+// encrypted or matches one of patterns.
+func (e *Env) IsSecret(key string, patterns []string) bool {
+	if slices.Contains(e.Secrets, key) {
+		return true
+	}
+	return MatchesSecret(key, patterns)
+}
+
+// MatchesSecret reports whether key matches one of the secret patterns
+func MatchesSecret(key string, patterns []string) bool {
+	key = strings.ToUpper(key)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToUpper(pattern), key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SecretValues returns the values of the secret keys in environ, a list
+// of KEY=VALUE entries.
+func (e *Env) SecretValues(environ []string, patterns []string) []string {
+	var values []string
+	for _, kv := range environ {
+		k, v, _ := strings.Cut(kv, "=")
+		if e.IsSecret(k, patterns) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// MaskDocument returns .env content with the values of secret keys
+// replaced by Masked, and whether any was. Keys are secret when annotated
+// with `# @secret` or when they match patterns; encrypted values are left
+// alone as they are unreadable anyway. Content that does not parse is
+// returned as is.
+func MaskDocument(content string, patterns []string) (string, bool) {
+	doc, err := dotenv.Parse(content)
+	if err != nil {
+		return content, false
+	}
+	marked := Directive(doc, "secret")
+	masked := false
+	for _, n := range doc.Variables() {
+		if n.Value == "" || vault.IsEncrypted(n.Value) {
+			continue
+		}
+		if slices.Contains(marked, n.Key) || MatchesSecret(n.Key, patterns) {
+			n.Value, n.Quote, n.Raw = Masked, 0, ""
+			masked = true
+		}
+	}
+	return doc.String(), masked
+}
+
+// MaskLines hides the given values in rendered terminal lines, which may
+// contain SGR sequences. The lines are searched as one run of text so a
+// value wrapped onto the next row is found as well, and each line of a
+// multi-line value is searched on its own. Every cell of a match becomes
+// a dot so columns stay where they were.
+func MaskLines(lines []string, values []string) []string {
+	var pieces []string
+	for _, v := range values {
+		for _, piece := range strings.Split(v, "\n") {
+			if piece = strings.TrimSuffix(piece, "\r"); len(piece) >= minMaskLen {
+				pieces = append(pieces, piece)
+			}
+		}
+	}
+	if len(pieces) == 0 {
+		return lines
+	}
+
+	// Collect the visible text and the rune each of its bytes belongs to
+	var text strings.Builder
+	var runeAt []int
+	n := 0
+	for _, line := range lines {
+		for i := 0; i < len(line); {
+			if k := escapeLen(line[i:]); k > 0 {
+				i += k
+				continue
+			}
+			_, size := utf8.DecodeRuneInString(line[i:])
+			text.WriteString(line[i : i+size])
+			for range size {
+				runeAt = append(runeAt, n)
+			}
+			n++
+			i += size
+		}
+	}
+
+	hidden := make([]bool, n)
+	found := false
+	s := text.String()
+	for _, piece := range pieces {
+		for from := 0; ; {
+			i := strings.Index(s[from:], piece)
+			if i < 0 {
+				break
+			}
+			i += from
+			for r := runeAt[i]; r <= runeAt[i+len(piece)-1]; r++ {
+				hidden[r] = true
+			}
+			found = true
+			from = i + 1
+		}
+	}
+	if !found {
+		return lines
+	}
+
+	masked := make([]string, len(lines))
+	n = 0
+	for j, line := range lines {
+		var b strings.Builder
+		for i := 0; i < len(line); {
+			if k := escapeLen(line[i:]); k > 0 {
+				b.WriteString(line[i : i+k])
+				i += k
+				continue
+			}
+			r, size := utf8.DecodeRuneInString(line[i:])
+			if hidden[n] {
+				b.WriteString(strings.Repeat("•", max(1, runewidth.RuneWidth(r))))
+			} else {
+				b.WriteString(line[i : i+size])
+			}
+			n++
+			i += size
+		}
+		masked[j] = b.String()
+	}
+	return masked
+}
+
+// escapeLen returns the length of the CSI sequence s starts with, or 0
+func escapeLen(s string) int {
+	if len(s) < 2 || s[0] != 0x1b || s[1] != '[' {
+		return 0
+	}
+	for i := 2; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return len(s)
+}
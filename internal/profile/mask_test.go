@@ -0,0 +1,108 @@
+package profile
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMaskLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		lines  []string
+		values []string
+		want   []string
+	}{
+		{
+			name:   "same width",
+			lines:  []string{"token=hunter2 ok"},
+			values: []string{"hunter2"},
+			want:   []string{"token=••••••• ok"},
+		},
+		{
+			name:   "wrapped onto the next row",
+			lines:  []string{"KEY=abcdef", "ghij done"},
+			values: []string{"abcdefghij"},
+			want:   []string{"KEY=••••••", "•••• done"},
+		},
+		{
+			name:   "split by the cursor",
+			lines:  []string{"pass: sec\x1b[0;7mr\x1b[0met!"},
+			values: []string{"secret"},
+			want:   []string{"pass: •••\x1b[0;7m•\x1b[0m••!"},
+		},
+		{
+			name:   "multi-line value",
+			lines:  []string{"-----BEGIN-----", "c2VjcmV0", "-----END-----"},
+			values: []string{"c2VjcmV0\nbm90aGluZw=="},
+			want:   []string{"-----BEGIN-----", "••••••••", "-----END-----"},
+		},
+		{
+			name:   "short values are left alone",
+			lines:  []string{"on at 1"},
+			values: []string{"on", "1"},
+			want:   []string{"on at 1"},
+		},
+		{
+			name:   "wide characters keep their columns",
+			lines:  []string{"pw 秘密です"},
+			values: []string{"秘密です"},
+			want:   []string{"pw ••••••••"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MaskLines(slices.Clone(tt.lines), tt.values)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("MaskLines(%q) = %q, want %q", tt.lines, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaskDocument(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		masked  bool
+	}{
+		{
+			name:    "annotated",
+			content: "# @secret DB_URL\nDB_URL=postgres://u:p@h/db\nPORT=80\n",
+			want:    "# @secret DB_URL\nDB_URL=" + Masked + "\nPORT=80\n",
+			masked:  true,
+		},
+		{
+			name:    "pattern",
+			content: "export API_TOKEN=\"" + long + "\" # ci\n",
+			want:    "export API_TOKEN=" + Masked + " # ci\n",
+			masked:  true,
+		},
+		{
+			name:    "multi-line",
+			content: "CERT_KEY=\"line one\nline two\"\nA=b\n",
+			want:    "CERT_KEY=" + Masked + "\nA=b\n",
+			masked:  true,
+		},
+		{
+			name:    "encrypted",
+			content: "API_KEY=enc:v1:abc\n",
+			want:    "API_KEY=enc:v1:abc\n",
+		},
+		{
+			name:    "nothing secret",
+			content: "A=b\n",
+			want:    "A=b\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, masked := MaskDocument(tt.content, DefaultSecretPatterns)
+			if got != tt.want || masked != tt.masked {
+				t.Errorf("MaskDocument() = %q, %v, want %q, %v", got, masked, tt.want, tt.masked)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/MasFana/fana-envy/internal/dotenv"
+	"github.com/MasFana/fana-envy/internal/vault"
+)
+
+// Env is a fully resolved profile, including everything it extends
+type Env struct {
+	Name    string
+	Vars    map[string]string
+	Sources map[string]string // Key -> profile that supplied its final value
+	Chain   []string          // Profiles merged, in order, ending with Name
+	Errors  []error
+
+	Isolated bool     // Children only get allowed host variables (`# @isolated`)
+	Allow    []string // Extra host variables or globs passed when isolated (`# @allow`)
+	Unset    []string // Inherited or host keys removed with `# @unset`
+	Secrets  []string // Keys marked with `# @secret` or stored encrypted
+	Schemas  []string // Schema files or templates to check against (`# @schema`)
+	Strict   bool     // Schema problems block commands (`# @strict`)
+}
+
+func Path(envDir, name string) string {
+	return filepath.Join(envDir, name+".env")
+}
+
+// Directive returns the comma separated arguments of every `# @name ...`
+// comment line in doc.
+func Directive(doc *dotenv.Document, name string) []string {
+	var args []string
+	for _, n := range doc.Nodes {
+		rest, ok := directive(n, name)
+		if !ok {
+			continue
+		}
+		for _, arg := range strings.Split(rest, ",") {
+			if arg = strings.TrimSpace(arg); arg != "" {
+				args = append(args, arg)
+			}
+		}
+	}
+	return args
+}
+
+// HasDirective reports whether doc contains a `# @name` line, with or
+// without arguments.
+func HasDirective(doc *dotenv.Document, name string) bool {
+	for _, n := range doc.Nodes {
+		if _, ok := directive(n, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func directive(n *dotenv.Node, name string) (string, bool) {
+	if n.Kind != dotenv.Comment {
+		return "", false
+	}
+	line := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(n.Raw), "#"))
+	rest, ok := strings.CutPrefix(line, "@"+name)
+	if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+		return "", false
+	}
+	return rest, true
+}
+
+// AddDirectiveArg adds arg to the `# @name` line of doc, creating the line
+// after the leading comment block when there is none.
+func AddDirectiveArg(doc *dotenv.Document, name, arg string) {
+	if slices.Contains(Directive(doc, name), arg) {
+		return
+	}
+	for _, n := range doc.Nodes {
+		if rest, ok := directive(n, name); ok {
+			if strings.TrimSpace(rest) == "" {
+				n.Raw = "# @" + name + " " + arg
+			} else {
+				n.Raw = "# @" + name + " " + strings.TrimSpace(rest) + "," + arg
+			}
+			return
+		}
+	}
+
+	i := 0
+	for i < len(doc.Nodes) && doc.Nodes[i].Kind == dotenv.Comment {
+		i++
+	}
+	node := &dotenv.Node{Kind: dotenv.Comment, Raw: "# @" + name + " " + arg}
+	doc.Nodes = slices.Insert(doc.Nodes, i, node)
+}
+
+// RemoveDirectiveArg drops arg from every `# @name` line of doc, removing
+// lines left without arguments.
+func RemoveDirectiveArg(doc *dotenv.Document, name, arg string) {
+	doc.Nodes = slices.DeleteFunc(doc.Nodes, func(n *dotenv.Node) bool {
+		rest, ok := directive(n, name)
+		if !ok {
+			return false
+		}
+		var keep []string
+		for _, a := range strings.Split(rest, ",") {
+			if a = strings.TrimSpace(a); a != "" && a != arg {
+				keep = append(keep, a)
+			}
+		}
+		if len(keep) == 0 {
+			return strings.TrimSpace(rest) != ""
+		}
+		n.Raw = "# @" + name + " " + strings.Join(keep, ",")
+		return false
+	})
+}
+
+// Read loads and parses a profile file. A parse error still returns the
+// part of the document read before the error.
+func Read(envDir, name string) (*dotenv.Document, error) {
+	content, err := os.ReadFile(Path(envDir, name))
+	if err != nil {
+		return nil, err
+	}
+	doc, err := dotenv.Parse(string(content))
+	if err != nil {
+		return doc, fmt.Errorf("%s.env: %w", name, err)
+	}
+	return doc, nil
+}
+
+// FileEnv describes one profile file as written, such as a history
+// revision: nothing is inherited, expanded or decrypted. Keys marked
+// `# @secret` and encrypted values count as secrets.
+func FileEnv(name, content string) (*Env, error) {
+	doc, err := dotenv.Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	env := &Env{
+		Name:    name,
+		Vars:    make(map[string]string),
+		Sources: make(map[string]string),
+		Chain:   []string{name},
+		Secrets: Directive(doc, "secret"),
+	}
+	for _, v := range dotenv.VarsOf(doc) {
+		env.Vars[v.Key] = v.Value
+		env.Sources[v.Key] = name
+		if vault.IsEncrypted(v.Value) {
+			env.Secrets = append(env.Secrets, v.Key)
+		}
+	}
+	return env, nil
+}
+
+type resolver struct {
+	envDir  string
+	stack   []string
+	seen    map[string]bool
+	vars    []dotenv.Var
+	sources []string
+	unset   map[string]bool
+	env     *Env
+
+	vault    *vault.Vault
+	vaultErr error
+}
+
+// Resolve merges the profiles named by `# @extends` directives, in order and
+// depth first, before the profile's own keys, then expands references
+// against the merged set and lookup. An isolated profile only sees the
+// host variables it allows, in references as in its commands.
+func Resolve(envDir, name string, lookup dotenv.Lookup) *Env {
+	env := &Env{
+		Name:    name,
+		Vars:    make(map[string]string),
+		Sources: make(map[string]string),
+	}
+	r := &resolver{envDir: envDir, seen: make(map[string]bool), unset: make(map[string]bool), env: env}
+	r.collect(name)
+
+	for k := range r.unset {
+		env.Unset = append(env.Unset, k)
+	}
+	sort.Strings(env.Unset)
+
+	// Unset keys are gone for references too
+	values, errs := dotenv.ExpandAll(r.vars, func(k string) (string, bool) {
+		if r.unset[k] || env.Isolated && !env.Allowed(k) {
+			return "", false
+		}
+		return lookup(k)
+	})
+	for i, v := range r.vars {
+		env.Sources[v.Key] = r.sources[i]
+	}
+	for k, v := range values {
+		env.Vars[k] = v
+	}
+	for _, err := range errs {
+		if e, ok := err.(*dotenv.ExpandError); ok {
+			err = fmt.Errorf("%s.env: %w", env.Sources[e.Key], e)
+		}
+		env.Errors = append(env.Errors, err)
+	}
+	return env
+}
+
+func (r *resolver) collect(name string) {
+	for i, p := range r.stack {
+		if p == name {
+			cycle := append(append([]string{}, r.stack[i:]...), name)
+			r.env.Errors = append(r.env.Errors, fmt.Errorf("@extends cycle: %s", strings.Join(cycle, " -> ")))
+			return
+		}
+	}
+	if r.seen[name] {
+		return
+	}
+	r.seen[name] = true
+
+	doc, err := Read(r.envDir, name)
+	if err != nil {
+		if os.IsNotExist(err) && len(r.stack) > 0 {
+			err = fmt.Errorf("%s.env: @extends unknown profile %q", r.stack[len(r.stack)-1], name)
+		}
+		r.env.Errors = append(r.env.Errors, err)
+		if doc == nil {
+			return
+		}
+	}
+
+	r.stack = append(r.stack, name)
+	for _, parent := range Directive(doc, "extends") {
+		r.collect(parent)
+	}
+	r.stack = r.stack[:len(r.stack)-1]
+
+	r.env.Chain = append(r.env.Chain, name)
+	if HasDirective(doc, "isolated") {
+		r.env.Isolated = true
+	}
+	r.env.Allow = append(r.env.Allow, Directive(doc, "allow")...)
+	r.env.Secrets = append(r.env.Secrets, Directive(doc, "secret")...)
+	r.env.Schemas = append(r.env.Schemas, Directive(doc, "schema")...)
+	if HasDirective(doc, "strict") {
+		r.env.Strict = true
+	}
+
+	// `@unset` drops what parents and the host defined; the profile's own
+	// keys and its children's still apply.
+	for _, key := range Directive(doc, "unset") {
+		r.unset[key] = true
+		for i := len(r.vars) - 1; i >= 0; i-- {
+			if r.vars[i].Key == key {
+				r.vars = slices.Delete(r.vars, i, i+1)
+				r.sources = slices.Delete(r.sources, i, i+1)
+			}
+		}
+	}
+	for _, v := range dotenv.VarsOf(doc) {
+		// Secrets are only decrypted in memory and never expanded
+		if vault.IsEncrypted(v.Value) {
+			plain, err := r.decrypt(v.Value)
+			if err != nil {
+				r.env.Errors = append(r.env.Errors, fmt.Errorf("%s.env: %s: %w", name, v.Key, err))
+				continue
+			}
+			v.Value, v.Literal = plain, true
+			r.env.Secrets = append(r.env.Secrets, v.Key)
+		}
+		delete(r.unset, v.Key)
+		r.vars = append(r.vars, v)
+		r.sources = append(r.sources, name)
+	}
+}
@@ -0,0 +1,138 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeProfiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name+".env"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func noHost(string) (string, bool) { return "", false }
+
+func TestResolveExtends(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		resolve string
+		vars    map[string]string
+		chain   []string
+		errs    []string // Substrings of the expected errors, in order
+	}{
+		{
+			name: "parents first",
+			files: map[string]string{
+				"base": "A=base\nB=base\n",
+				"dev":  "# @extends base\nB=dev\nC=${A}-${B}\n",
+			},
+			resolve: "dev",
+			vars:    map[string]string{"A": "base", "B": "dev", "C": "base-dev"},
+			chain:   []string{"base", "dev"},
+		},
+		{
+			name: "diamond",
+			files: map[string]string{
+				"base": "A=base\n",
+				"db":   "# @extends base\nDB=1\n",
+				"web":  "# @extends base\nA=web\n",
+				"app":  "# @extends db, web\n",
+			},
+			resolve: "app",
+			vars:    map[string]string{"A": "web", "DB": "1"},
+			chain:   []string{"base", "db", "web", "app"},
+		},
+		{
+			name:    "extends itself",
+			files:   map[string]string{"a": "# @extends a\nA=1\n"},
+			resolve: "a",
+			vars:    map[string]string{"A": "1"},
+			chain:   []string{"a"},
+			errs:    []string{"@extends cycle: a -> a"},
+		},
+		{
+			name: "loop",
+			files: map[string]string{
+				"a": "# @extends b\nA=1\n",
+				"b": "# @extends c\nB=2\n",
+				"c": "# @extends a\nC=3\n",
+			},
+			resolve: "a",
+			vars:    map[string]string{"A": "1", "B": "2", "C": "3"},
+			chain:   []string{"c", "b", "a"},
+			errs:    []string{"@extends cycle: a -> b -> c -> a"},
+		},
+		{
+			name:    "unknown parent",
+			files:   map[string]string{"a": "# @extends ghost\nA=1\n"},
+			resolve: "a",
+			vars:    map[string]string{"A": "1"},
+			chain:   []string{"a"},
+			errs:    []string{`a.env: @extends unknown profile "ghost"`},
+		},
+		{
+			name: "unset inherited",
+			files: map[string]string{
+				"base": "A=1\nB=2\n",
+				"dev":  "# @extends base\n# @unset A\nC=${A:-none}\n",
+			},
+			resolve: "dev",
+			vars:    map[string]string{"B": "2", "C": "none"},
+			chain:   []string{"base", "dev"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := Resolve(writeProfiles(t, tt.files), tt.resolve, noHost)
+			if len(env.Vars) != len(tt.vars) {
+				t.Errorf("Vars = %v, want %v", env.Vars, tt.vars)
+			}
+			for k, v := range tt.vars {
+				if env.Vars[k] != v {
+					t.Errorf("%s = %q, want %q", k, env.Vars[k], v)
+				}
+			}
+			if !slices.Equal(env.Chain, tt.chain) {
+				t.Errorf("Chain = %v, want %v", env.Chain, tt.chain)
+			}
+			if len(env.Errors) != len(tt.errs) {
+				t.Fatalf("Errors = %v, want %q", env.Errors, tt.errs)
+			}
+			for i, err := range env.Errors {
+				if !strings.Contains(err.Error(), tt.errs[i]) {
+					t.Errorf("error %d = %v, want one containing %q", i, err, tt.errs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestResolveIsolatedLookup(t *testing.T) {
+	host := map[string]string{"HOME": "/home/me", "TOKEN": "t0k", "REGION": "eu"}
+	lookup := func(k string) (string, bool) {
+		v, ok := host[k]
+		return v, ok
+	}
+	dir := writeProfiles(t, map[string]string{
+		"base": "# @isolated\n# @allow REGION\n",
+		"dev":  "# @extends base\nCACHE=${HOME}/.cache\nAUTH=${TOKEN:-none}\nZONE=${REGION}-1\n",
+	})
+
+	env := Resolve(dir, "dev", lookup)
+	want := map[string]string{"CACHE": "/home/me/.cache", "AUTH": "none", "ZONE": "eu-1"}
+	for k, v := range want {
+		if env.Vars[k] != v {
+			t.Errorf("%s = %q, want %q", k, env.Vars[k], v)
+		}
+	}
+}
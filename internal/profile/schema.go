@@ -0,0 +1,81 @@
+package profile
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MasFana/fana-envy/internal/schema"
+	"github.com/MasFana/fana-envy/internal/secrets"
+)
+
+// Schema loads the schema files and templates named by `# @schema`,
+// relative to dir, the directory commands run in. It returns nil when the
+// profile has none.
+func (e *Env) Schema(dir string) (*schema.Schema, error) {
+	if len(e.Schemas) == 0 {
+		return nil, nil
+	}
+	s := &schema.Schema{}
+	for _, p := range e.Schemas {
+		if p == "~" || strings.HasPrefix(p, "~/") {
+			home, _ := os.UserHomeDir()
+			p = filepath.Join(home, p[1:])
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		part, err := schema.Load(p)
+		if err != nil {
+			return nil, err
+		}
+		s.Merge(part)
+	}
+	return s, nil
+}
+
+// ChildEnv returns the environment of a command started in dir: BuildEnv
+// with the defaults of the schema layered over defaults. A schema that
+// fails to load adds nothing; Check reports it.
+func (e *Env) ChildEnv(dir string, defaults, overrides map[string]string) []string {
+	defaults = maps.Clone(defaults)
+	if s, _ := e.Schema(dir); s != nil {
+		if defaults == nil {
+			defaults = make(map[string]string)
+		}
+		maps.Copy(defaults, s.Defaults())
+	}
+	return BuildEnv(e, defaults, overrides)
+}
+
+// Check validates environ, as returned by BuildEnv, against the profile's
+// schema. Values still referring to a secret provider are only checked for
+// presence since they are fetched when a command starts.
+func (e *Env) Check(dir string, environ []string) []error {
+	s, err := e.Schema(dir)
+	if err != nil {
+		return []error{err}
+	}
+	if s == nil {
+		return nil
+	}
+
+	values := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		k, v, _ := strings.Cut(kv, "=")
+		values[envKey(k)] = v
+	}
+	var problems []error
+	for _, err := range s.Validate(func(key string) (string, bool) {
+		v, ok := values[envKey(key)]
+		return v, ok
+	}) {
+		p := err.(*schema.Problem)
+		if _, ref := secrets.Parse(values[envKey(p.Key)]); ref {
+			continue
+		}
+		problems = append(problems, err)
+	}
+	return problems
+}
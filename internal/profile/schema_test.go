@@ -0,0 +1,32 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestChildEnvSchemaDefaults(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "app.schema"), []byte("ENVY_TEST_PORT port default=8080\nENVY_TEST_LEVEL enum(debug,info) default=info\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &Env{
+		Vars:    map[string]string{"ENVY_TEST_LEVEL": "debug"},
+		Schemas: []string{"app.schema"},
+	}
+
+	environ := env.ChildEnv(dir, map[string]string{"ENVY_TEST_INJECTED": "1"}, map[string]string{"ENVY_TEST_EXTRA": "x"})
+	for _, want := range []string{"ENVY_TEST_PORT=8080", "ENVY_TEST_LEVEL=debug", "ENVY_TEST_INJECTED=1", "ENVY_TEST_EXTRA=x"} {
+		if !slices.Contains(environ, want) {
+			t.Errorf("ChildEnv() lacks %s", want)
+		}
+	}
+
+	env.Schemas = []string{"missing.schema"}
+	if environ := env.ChildEnv(dir, nil, nil); !slices.Contains(environ, "ENVY_TEST_LEVEL=debug") {
+		t.Errorf("ChildEnv() with a broken schema lacks the profile's own variables")
+	}
+}
@@ -0,0 +1,227 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MasFana/fana-envy/internal/dotenv"
+	"github.com/MasFana/fana-envy/internal/storage"
+	"github.com/MasFana/fana-envy/internal/utils"
+	"github.com/MasFana/fana-envy/internal/vault"
+)
+
+// SetSecret stores value encrypted, creating the key file on first use
+func SetSecret(envDir, name, key, value string) error {
+	if !utils.IsValidEnvVar(key) {
+		return ErrInvalidKey
+	}
+	v, err := vault.OpenOrCreate(envDir)
+	if err != nil {
+		return err
+	}
+	sealed, err := v.Encrypt(value)
+	if err != nil {
+		return err
+	}
+	return Update(envDir, name, "secret", func(doc *dotenv.Document) error {
+		doc.SetLiteral(key, sealed)
+		RemoveDirectiveArg(doc, "unset", key)
+		return nil
+	})
+}
+
+// EncryptMarked replaces `KEY=encrypt:value` entries of doc with encrypted
+// values and returns how many it changed.
+func EncryptMarked(envDir string, doc *dotenv.Document) (int, error) {
+	var v *vault.Vault
+	count := 0
+	for _, n := range doc.Variables() {
+		plain, ok := strings.CutPrefix(n.Value, vault.EncryptPrefix)
+		if !ok {
+			continue
+		}
+		if v == nil {
+			var err error
+			if v, err = vault.OpenOrCreate(envDir); err != nil {
+				return count, err
+			}
+		}
+		sealed, err := v.Encrypt(plain)
+		if err != nil {
+			return count, err
+		}
+		setValue(n, sealed)
+		count++
+	}
+	return count, nil
+}
+
+// Rotation is what RotateKey changed
+type Rotation struct {
+	Values    map[string]int // Values re-encrypted per profile
+	Revisions int            // History revisions re-encrypted
+	Purged    int            // Revisions deleted since their values could not be decrypted
+}
+
+// RotateKey re-encrypts every secret in envDir with a new key and then
+// replaces the stored key. Nothing is written when a value of a profile
+// cannot be decrypted. The history is re-encrypted too, so revisions can
+// still be restored; revisions holding values of an even older key are
+// deleted.
+func RotateKey(envDir string) (*Rotation, error) {
+	unlock, err := storage.Lock(envDir)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	old, err := vault.Open(envDir)
+	if err != nil {
+		return nil, err
+	}
+	next, err := vault.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := List(envDir)
+	if err != nil {
+		return nil, err
+	}
+	docs := make(map[string]*dotenv.Document)
+	counts := make(map[string]int)
+	for _, name := range names {
+		doc, err := Read(envDir, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range doc.Variables() {
+			if !vault.IsEncrypted(n.Value) {
+				continue
+			}
+			plain, err := old.Decrypt(n.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s.env: %s: %w", name, n.Key, err)
+			}
+			sealed, err := next.Encrypt(plain)
+			if err != nil {
+				return nil, err
+			}
+			setValue(n, sealed)
+			counts[name]++
+		}
+		if counts[name] > 0 {
+			docs[name] = doc
+		}
+	}
+
+	if err := next.Stage(envDir); err != nil {
+		return nil, err
+	}
+	for name, doc := range docs {
+		if err := write(envDir, name, doc.String(), "rotate"); err != nil {
+			return nil, err
+		}
+	}
+	rot := &Rotation{Values: counts}
+	if err := rotateHistory(envDir, old, next, rot); err != nil {
+		return nil, err
+	}
+	return rot, next.Commit(envDir)
+}
+
+// rotateHistory re-encrypts the values of all saved revisions, including
+// those of deleted profiles. Values already using the new key, as in the
+// revisions just written, are left alone.
+func rotateHistory(envDir string, old, next *vault.Vault, rot *Rotation) error {
+	dirs, err := os.ReadDir(filepath.Join(envDir, HistoryDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		revs, err := Revisions(envDir, d.Name())
+		if err != nil {
+			return err
+		}
+		for _, rev := range revs {
+			data, err := os.ReadFile(rev.Path)
+			if err != nil {
+				return err
+			}
+			changed, ok := reencrypt(string(data), old, next)
+			switch {
+			case !ok:
+				if err := os.Remove(rev.Path); err != nil {
+					return err
+				}
+				rot.Purged++
+			case changed != string(data):
+				if err := storage.WriteFile(rev.Path, []byte(changed), 0644); err != nil {
+					return err
+				}
+				rot.Revisions++
+			}
+		}
+	}
+	return nil
+}
+
+// reencrypt returns content with its values moved from old to next, and
+// false when one of them can be decrypted by neither key
+func reencrypt(content string, old, next *vault.Vault) (string, bool) {
+	doc, err := dotenv.Parse(content)
+	if err != nil {
+		return content, !strings.Contains(content, vault.Prefix)
+	}
+	changed := false
+	for _, n := range doc.Variables() {
+		if !vault.IsEncrypted(n.Value) {
+			continue
+		}
+		plain, err := old.Decrypt(n.Value)
+		if errors.Is(err, vault.ErrWrongKey) {
+			if _, err := next.Decrypt(n.Value); err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			return content, false
+		}
+		sealed, err := next.Encrypt(plain)
+		if err != nil {
+			return content, false
+		}
+		setValue(n, sealed)
+		changed = true
+	}
+	if !changed {
+		return content, true
+	}
+	return doc.String(), true
+}
+
+// setValue replaces a value in place, keeping export and inline comments
+func setValue(n *dotenv.Node, value string) {
+	n.Value, n.Quote, n.Raw = value, 0, ""
+}
+
+// decrypt opens an encrypted value for the resolver, loading the key on
+// first use.
+func (r *resolver) decrypt(value string) (string, error) {
+	if r.vault == nil && r.vaultErr == nil {
+		r.vault, r.vaultErr = vault.Open(r.envDir)
+	}
+	if r.vaultErr != nil {
+		return "", r.vaultErr
+	}
+	return r.vault.Decrypt(value)
+}
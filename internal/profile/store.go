@@ -0,0 +1,148 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MasFana/fana-envy/internal/dotenv"
+	"github.com/MasFana/fana-envy/internal/storage"
+	"github.com/MasFana/fana-envy/internal/utils"
+)
+
+const DefaultName = "default"
+
+var (
+	ErrInvalidName = errors.New("invalid profile name")
+	ErrInvalidKey  = errors.New("invalid variable name")
+	ErrExists      = errors.New("profile already exists")
+	ErrNotFound    = errors.New("profile not found")
+	ErrProtected   = errors.New("the default profile cannot be renamed or deleted")
+)
+
+// List returns the names of all profiles in envDir, sorted
+func List(envDir string) ([]string, error) {
+	files, err := os.ReadDir(envDir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".env") {
+			names = append(names, strings.TrimSuffix(f.Name(), ".env"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func Exists(envDir, name string) bool {
+	_, err := os.Stat(Path(envDir, name))
+	return err == nil
+}
+
+// Create writes a new, empty profile
+func Create(envDir, name string) error {
+	if !utils.IsValidProfileName(name) {
+		return ErrInvalidName
+	}
+	return storage.Locked(envDir, func() error {
+		if Exists(envDir, name) {
+			return ErrExists
+		}
+		content := fmt.Sprintf("# %s\n# Created: %s\n", name, time.Now().Format("2006-01-02"))
+		defer remember(Path(envDir, name))
+		return storage.WriteFile(Path(envDir, name), []byte(content), 0644)
+	})
+}
+
+func Rename(envDir, oldName, newName string) error {
+	if !utils.IsValidProfileName(newName) {
+		return ErrInvalidName
+	}
+	if oldName == DefaultName {
+		return ErrProtected
+	}
+	return storage.Locked(envDir, func() error {
+		if !Exists(envDir, oldName) {
+			return ErrNotFound
+		}
+		if Exists(envDir, newName) {
+			return ErrExists
+		}
+		if err := os.Rename(Path(envDir, oldName), Path(envDir, newName)); err != nil {
+			return err
+		}
+		remember(Path(envDir, oldName))
+		remember(Path(envDir, newName))
+		return moveHistory(envDir, oldName, newName)
+	})
+}
+
+func Delete(envDir, name string) error {
+	if name == DefaultName {
+		return ErrProtected
+	}
+	return storage.Locked(envDir, func() error {
+		if !Exists(envDir, name) {
+			return ErrNotFound
+		}
+		defer remember(Path(envDir, name))
+		return os.Remove(Path(envDir, name))
+	})
+}
+
+// Update applies edit to a profile file and writes it back, keeping
+// comments and untouched lines as they were. Files that do not parse
+// cleanly are never rewritten. source names the change in the history.
+func Update(envDir, name, source string, edit func(doc *dotenv.Document) error) error {
+	return storage.Locked(envDir, func() error {
+		doc, err := Read(envDir, name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if err := edit(doc); err != nil {
+			return err
+		}
+		return write(envDir, name, doc.String(), source)
+	})
+}
+
+func Set(envDir, name, key, value string) error {
+	if !utils.IsValidEnvVar(key) {
+		return ErrInvalidKey
+	}
+	return Update(envDir, name, "set", func(doc *dotenv.Document) error {
+		doc.SetLiteral(key, value)
+		RemoveDirectiveArg(doc, "unset", key)
+		return nil
+	})
+}
+
+// Unset removes key from a profile and reports whether it was defined there
+func Unset(envDir, name, key string) (bool, error) {
+	found := false
+	err := Update(envDir, name, "unset", func(doc *dotenv.Document) error {
+		found = doc.Unset(key)
+		return nil
+	})
+	return found, err
+}
+
+// UnsetInherited records `# @unset key` so the key stops reaching children
+// from parent profiles, injected defaults or the host environment.
+func UnsetInherited(envDir, name, key string) error {
+	if !utils.IsValidEnvVar(key) {
+		return ErrInvalidKey
+	}
+	return Update(envDir, name, "unset", func(doc *dotenv.Document) error {
+		AddDirectiveArg(doc, "unset", key)
+		return nil
+	})
+}
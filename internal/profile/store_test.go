@@ -0,0 +1,24 @@
+package profile
+
+import "testing"
+
+func TestSetRoundTrip(t *testing.T) {
+	values := map[string]string{
+		"PASSWORD": "pa$$word",
+		"PRICE":    "it's $5",
+		"TEMPLATE": "${HOME}/x",
+		"PLAIN":    "hello",
+	}
+	dir := writeProfiles(t, map[string]string{"dev": ""})
+	for k, v := range values {
+		if err := Set(dir, "dev", k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env := Resolve(dir, "dev", noHost)
+	for k, v := range values {
+		if env.Vars[k] != v {
+			t.Errorf("%s = %q, want %q", k, env.Vars[k], v)
+		}
+	}
+}
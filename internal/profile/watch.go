@@ -0,0 +1,98 @@
+package profile
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/MasFana/fana-envy/internal/storage"
+)
+
+// ErrChanged reports a profile modified on disk since it was read
+var ErrChanged = errors.New("changed on disk")
+
+// Stamp identifies one version of a profile file. The zero Stamp stands
+// for a missing file.
+type Stamp struct {
+	ModTime time.Time
+	Size    int64
+}
+
+// Writes of this process, so watchers can tell them from edits made
+// elsewhere
+var (
+	ownMu sync.Mutex
+	own   = make(map[string]Stamp) // File path -> stamp after our last write
+)
+
+func stampOf(path string) Stamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Stamp{}
+	}
+	return Stamp{ModTime: info.ModTime(), Size: info.Size()}
+}
+
+// remember records that this process just wrote or removed path
+func remember(path string) {
+	ownMu.Lock()
+	own[path] = stampOf(path)
+	ownMu.Unlock()
+}
+
+// Stamps returns the current stamp of every profile in envDir
+func Stamps(envDir string) (map[string]Stamp, error) {
+	names, err := List(envDir)
+	if err != nil {
+		return nil, err
+	}
+	stamps := make(map[string]Stamp, len(names))
+	for _, name := range names {
+		stamps[name] = stampOf(Path(envDir, name))
+	}
+	return stamps, nil
+}
+
+// Changed returns the profiles that were added, modified or removed
+// between two Stamps results by someone other than this process.
+func Changed(envDir string, old, cur map[string]Stamp) []string {
+	ownMu.Lock()
+	defer ownMu.Unlock()
+
+	var names []string
+	check := func(name string) {
+		if old[name] == cur[name] {
+			return
+		}
+		if s, ok := own[Path(envDir, name)]; ok && s == cur[name] {
+			return
+		}
+		names = append(names, name)
+	}
+	for name := range cur {
+		check(name)
+	}
+	for name := range old {
+		if _, ok := cur[name]; !ok {
+			check(name)
+		}
+	}
+	return names
+}
+
+// WriteIfUnchanged is Write for content edited from base, the text read
+// earlier. It fails with ErrChanged when the file no longer holds base,
+// instead of overwriting what changed in the meantime.
+func WriteIfUnchanged(envDir, name, base, content, source string) error {
+	return storage.Locked(envDir, func() error {
+		current, err := os.ReadFile(Path(envDir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err != nil || string(current) != base {
+			return ErrChanged
+		}
+		return write(envDir, name, content, source)
+	})
+}
@@ -0,0 +1,265 @@
+// Package schema checks environments against the keys a project expects,
+// declared in a schema file or taken from a template such as .env.example.
+package schema
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/MasFana/fana-envy/internal/dotenv"
+)
+
+// Types lists the value types a rule can check
+var Types = []string{"string", "int", "bool", "url", "port", "enum", "regex"}
+
+// Rule is what the schema expects of one key
+type Rule struct {
+	Key        string
+	Type       string
+	Enum       []string       // Allowed values of an enum
+	Pattern    *regexp.Regexp // Whole value match of a regex
+	Default    string
+	HasDefault bool
+	Optional   bool
+}
+
+// Schema is an ordered set of rules, one per key
+type Schema struct {
+	Rules []Rule
+}
+
+// Problem is a missing or invalid key
+type Problem struct {
+	Key string
+	Msg string
+}
+
+func (p *Problem) Error() string {
+	return p.Key + ": " + p.Msg
+}
+
+// Load reads a schema file (*.schema) or, for any other file, a template
+// like .env.example whose keys are all required.
+func Load(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) == ".schema" {
+		s, err := Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		return s, nil
+	}
+
+	doc, err := dotenv.Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	s := &Schema{}
+	for _, n := range doc.Variables() {
+		s.Add(Rule{Key: n.Key, Type: "string"})
+	}
+	return s, nil
+}
+
+// Parse reads the schema format, one key per line followed by its rules:
+//
+//	PORT      port default=8080
+//	LOG_LEVEL enum(debug,info,warn) default=info
+//	API_URL   url
+//	TOKEN     regex(tok_[a-z0-9]+)
+//	SENTRY    string optional
+//
+// Keys are required unless marked optional or given a default.
+func Parse(src string) (*Schema, error) {
+	s := &Schema{}
+	for i, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		s.Add(rule)
+	}
+	return s, nil
+}
+
+func parseRule(line string) (Rule, error) {
+	key, rest := line, ""
+	if i := strings.IndexFunc(line, unicode.IsSpace); i >= 0 {
+		key, rest = line[:i], line[i:]
+	}
+	if !validKey(key) {
+		return Rule{}, fmt.Errorf("invalid key %q", key)
+	}
+	rule := Rule{Key: key, Type: "string"}
+
+	rest = strings.TrimSpace(rest)
+	for rest != "" {
+		var token string
+		token, rest = nextToken(rest)
+		switch {
+		case token == "optional":
+			rule.Optional = true
+		case strings.HasPrefix(token, "default="):
+			v := strings.TrimPrefix(token, "default=")
+			if strings.HasPrefix(v, `"`) {
+				uq, err := strconv.Unquote(v)
+				if err != nil {
+					return Rule{}, fmt.Errorf("%s: bad default %s", key, v)
+				}
+				v = uq
+			}
+			rule.Default, rule.HasDefault = v, true
+		case strings.HasPrefix(token, "enum(") && strings.HasSuffix(token, ")"):
+			rule.Type = "enum"
+			for _, v := range strings.Split(token[5:len(token)-1], ",") {
+				rule.Enum = append(rule.Enum, strings.TrimSpace(v))
+			}
+		case strings.HasPrefix(token, "regex(") && strings.HasSuffix(token, ")"):
+			re, err := regexp.Compile("^(?:" + token[6:len(token)-1] + ")$")
+			if err != nil {
+				return Rule{}, fmt.Errorf("%s: %w", key, err)
+			}
+			rule.Type, rule.Pattern = "regex", re
+		case slices.Contains(Types, token) && token != "enum" && token != "regex":
+			rule.Type = token
+		default:
+			return Rule{}, fmt.Errorf("%s: unknown rule %q (types: %s)", key, token, strings.Join(Types, ", "))
+		}
+		rest = strings.TrimSpace(rest)
+	}
+	return rule, nil
+}
+
+// nextToken splits off one rule. Parentheses and double quotes may hold
+// spaces, so `regex(a b)` and `default="a b"` are single tokens.
+func nextToken(s string) (string, string) {
+	depth, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ' ' || c == '\t':
+			if depth <= 0 {
+				return s[:i], s[i:]
+			}
+		}
+	}
+	return s, ""
+}
+
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, c := range key {
+		if c != '_' && !(c >= 'A' && c <= 'Z') && !(c >= 'a' && c <= 'z') && !(i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Add sets the rule for a key, replacing an earlier one
+func (s *Schema) Add(rule Rule) {
+	for i, r := range s.Rules {
+		if r.Key == rule.Key {
+			s.Rules[i] = rule
+			return
+		}
+	}
+	s.Rules = append(s.Rules, rule)
+}
+
+// Merge adds the rules of other, which win over rules for the same keys
+func (s *Schema) Merge(other *Schema) {
+	for _, r := range other.Rules {
+		s.Add(r)
+	}
+}
+
+// Defaults returns the default of every key that has one
+func (s *Schema) Defaults() map[string]string {
+	if s == nil {
+		return nil
+	}
+	defaults := make(map[string]string)
+	for _, r := range s.Rules {
+		if r.HasDefault {
+			defaults[r.Key] = r.Default
+		}
+	}
+	return defaults
+}
+
+// Validate returns a problem for every required key lookup does not find
+// (or finds empty) and every value of the wrong type. Values are left out
+// of the messages since they may be secret.
+func (s *Schema) Validate(lookup dotenv.Lookup) []error {
+	var problems []error
+	for _, r := range s.Rules {
+		v, ok := lookup(r.Key)
+		if !ok || v == "" {
+			if !r.Optional && !r.HasDefault {
+				problems = append(problems, &Problem{r.Key, "missing"})
+			}
+			continue
+		}
+		if msg := r.check(v); msg != "" {
+			problems = append(problems, &Problem{r.Key, msg})
+		}
+	}
+	return problems
+}
+
+func (r Rule) check(v string) string {
+	switch r.Type {
+	case "int":
+		if _, err := strconv.Atoi(v); err != nil {
+			return "not an integer"
+		}
+	case "bool":
+		switch strings.ToLower(v) {
+		case "true", "false", "1", "0", "yes", "no", "on", "off":
+		default:
+			return "not a boolean"
+		}
+	case "url":
+		if u, err := url.Parse(v); err != nil || u.Scheme == "" || (u.Host == "" && u.Opaque == "") {
+			return "not a URL"
+		}
+	case "port":
+		if n, err := strconv.Atoi(v); err != nil || n < 1 || n > 65535 {
+			return "not a port (1-65535)"
+		}
+	case "enum":
+		if !slices.Contains(r.Enum, v) {
+			return "not one of " + strings.Join(r.Enum, ", ")
+		}
+	case "regex":
+		if !r.Pattern.MatchString(v) {
+			return "does not match " + strings.TrimSuffix(strings.TrimPrefix(r.Pattern.String(), "^(?:"), ")$")
+		}
+	}
+	return ""
+}
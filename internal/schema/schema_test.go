@@ -0,0 +1,55 @@
+package schema
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want Rule
+		err  bool
+	}{
+		{name: "key only", src: "API_URL", want: Rule{Key: "API_URL", Type: "string"}},
+		{name: "tab", src: "PORT\tport", want: Rule{Key: "PORT", Type: "port"}},
+		{name: "tabs and spaces", src: "PORT \t port\tdefault=8080", want: Rule{Key: "PORT", Type: "port", Default: "8080", HasDefault: true}},
+		{name: "quoted default", src: `GREETING string default="hello world"`, want: Rule{Key: "GREETING", Type: "string", Default: "hello world", HasDefault: true}},
+		{name: "enum", src: "LEVEL\tenum(debug, info) optional", want: Rule{Key: "LEVEL", Type: "enum", Enum: []string{"debug", "info"}, Optional: true}},
+		{name: "unknown rule", src: "PORT\tnumber", err: true},
+		{name: "invalid key", src: "1PORT port", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse("# comment\n\n" + tt.src + "\n")
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Parse(%q) succeeded, want an error", tt.src)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.src, err)
+			}
+			if len(s.Rules) != 1 {
+				t.Fatalf("Parse(%q) = %d rules, want 1", tt.src, len(s.Rules))
+			}
+			got := s.Rules[0]
+			if got.Key != tt.want.Key || got.Type != tt.want.Type || got.Default != tt.want.Default ||
+				got.HasDefault != tt.want.HasDefault || got.Optional != tt.want.Optional || !slices.Equal(got.Enum, tt.want.Enum) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRegexWithSpaces(t *testing.T) {
+	s, err := Parse("NAME\tregex(a b|c)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := s.Rules[0]; r.Pattern == nil || !r.Pattern.MatchString("a b") || r.Pattern.MatchString("a") {
+		t.Errorf("regex rule = %+v", r)
+	}
+}
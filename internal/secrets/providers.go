@@ -0,0 +1,91 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Command runs `@cmd:` references with the shell and uses their standard
+// output, e.g. `@cmd:pass show db/prod` or `@cmd:op read op://vault/db/pass`.
+type Command struct{}
+
+func (Command) Fetch(ctx context.Context, ref Ref) (string, error) {
+	if ref.Arg == "" {
+		return "", errors.New("empty command")
+	}
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.CommandContext(ctx, "cmd", "/C", ref.Arg)
+	} else {
+		c = exec.CommandContext(ctx, "sh", "-c", ref.Arg)
+	}
+	c.Dir = ref.Dir
+	// Grandchildren holding the pipes must not outlive the timeout
+	c.WaitDelay = time.Second
+
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		if msg := firstLine(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return trimNewline(string(out)), nil
+}
+
+// File reads `@file:` references, e.g. Docker or Kubernetes secret mounts
+// like `@file:/run/secrets/db`. Relative paths are taken from the
+// command's directory.
+type File struct{}
+
+func (File) Fetch(ctx context.Context, ref Ref) (string, error) {
+	path := ref.Arg
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, path[1:])
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(ref.Dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return trimNewline(string(data)), nil
+}
+
+// Env copies another variable of the host environment, e.g.
+// `@env:CI_DEPLOY_TOKEN`.
+type Env struct{}
+
+func (Env) Fetch(ctx context.Context, ref Ref) (string, error) {
+	v, ok := os.LookupEnv(ref.Arg)
+	if !ok {
+		return "", errors.New("variable is not set")
+	}
+	return v, nil
+}
+
+// trimNewline drops the single line ending most tools print after a value
+func trimNewline(s string) string {
+	s = strings.TrimSuffix(s, "\n")
+	return strings.TrimSuffix(s, "\r")
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
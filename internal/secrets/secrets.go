@@ -0,0 +1,174 @@
+// Package secrets resolves profile values that point to an external
+// source, such as `DB_PASS=@cmd:pass show db/prod`, when a command is
+// started, so the value itself never has to be stored in a profile.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds how long a single provider may take
+const DefaultTimeout = 10 * time.Second
+
+// Ref is a parsed `@provider:arg` reference
+type Ref struct {
+	Provider string
+	Arg      string
+	Dir      string // Working directory of the command being started
+}
+
+func (r Ref) String() string {
+	return "@" + r.Provider + ":" + r.Arg
+}
+
+// Provider fetches the value a reference points to. Fetch must return
+// when ctx is done.
+type Provider interface {
+	Fetch(ctx context.Context, ref Ref) (string, error)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]Provider{
+		"cmd":  Command{},
+		"file": File{},
+		"env":  Env{},
+	}
+)
+
+// Register makes a provider available as `@name:`
+func Register(name string, p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[name] = p
+}
+
+// Providers lists the registered provider names, sorted
+func Providers() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookup(name string) (Provider, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := providers[name]
+	return p, ok
+}
+
+var refPattern = regexp.MustCompile(`^@([a-z][a-z0-9_-]*):(.*)$`)
+
+// Parse reports whether value references a registered provider. Values
+// like `@scope/pkg` or `@unknown:x` are plain values.
+func Parse(value string) (Ref, bool) {
+	m := refPattern.FindStringSubmatch(value)
+	if m == nil {
+		return Ref{}, false
+	}
+	if _, ok := lookup(m[1]); !ok {
+		return Ref{}, false
+	}
+	return Ref{Provider: m[1], Arg: strings.TrimSpace(m[2])}, true
+}
+
+// Error reports a reference that could not be resolved
+type Error struct {
+	Key string
+	Ref Ref
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.Key, e.Ref, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Resolver fetches references and caches the values for the session
+type Resolver struct {
+	Timeout time.Duration
+
+	mu    sync.Mutex
+	cache map[Ref]string
+}
+
+func NewResolver(timeout time.Duration) *Resolver {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Resolver{Timeout: timeout, cache: make(map[Ref]string)}
+}
+
+// Resolve fetches a single reference, from the cache when possible
+func (r *Resolver) Resolve(ref Ref) (string, error) {
+	r.mu.Lock()
+	v, ok := r.cache[ref]
+	r.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+
+	p, ok := lookup(ref.Provider)
+	if !ok {
+		return "", fmt.Errorf("unknown provider %q", ref.Provider)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.Timeout)
+	defer cancel()
+	v, err := p.Fetch(ctx, ref)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("timed out after %v", r.Timeout)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	r.cache[ref] = v
+	r.mu.Unlock()
+	return v, nil
+}
+
+// Environ replaces references in environ, a list of KEY=VALUE entries,
+// with the values they point to; dir is where the command will run. Only
+// entries holding the value of the same key in own, the profile's
+// variables, are resolved: host variables and overrides are passed as they
+// are, so a value from elsewhere never runs a command. It also returns the
+// fetched values so callers can mask them. Entries that fail are left out
+// and reported in the error.
+func (r *Resolver) Environ(environ []string, own map[string]string, dir string) ([]string, []string, error) {
+	out := make([]string, 0, len(environ))
+	var fetched []string
+	var errs []error
+	for _, kv := range environ {
+		k, v, _ := strings.Cut(kv, "=")
+		ref, ok := Parse(v)
+		if mine, found := own[k]; !ok || !found || mine != v {
+			out = append(out, kv)
+			continue
+		}
+		ref.Dir = dir
+		value, err := r.Resolve(ref)
+		if err != nil {
+			errs = append(errs, &Error{Key: k, Ref: ref, Err: err})
+			continue
+		}
+		out = append(out, k+"="+value)
+		fetched = append(fetched, value)
+	}
+	return out, fetched, errors.Join(errs...)
+}
@@ -0,0 +1,37 @@
+package secrets
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEnvironResolvesOnlyProfileKeys(t *testing.T) {
+	t.Setenv("ENVY_TEST_SOURCE", "fetched")
+	environ := []string{
+		"OWN=@env:ENVY_TEST_SOURCE",
+		"HOST=@env:ENVY_TEST_SOURCE",
+		"OVERRIDDEN=@env:ENVY_TEST_SOURCE",
+		"PLAIN=value",
+	}
+	own := map[string]string{
+		"OWN":        "@env:ENVY_TEST_SOURCE",
+		"OVERRIDDEN": "something else",
+		"PLAIN":      "value",
+	}
+	got, fetched, err := NewResolver(0).Environ(environ, own, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"OWN=fetched",
+		"HOST=@env:ENVY_TEST_SOURCE",
+		"OVERRIDDEN=@env:ENVY_TEST_SOURCE",
+		"PLAIN=value",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !slices.Equal(fetched, []string{"fetched"}) {
+		t.Errorf("fetched %q", fetched)
+	}
+}
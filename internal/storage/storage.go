@@ -0,0 +1,93 @@
+// Package storage writes the files Fana-Envy keeps in envs/. Writes go to
+// a temporary file that is renamed over the target, so a crash never
+// leaves a half written profile, and instances running at the same time
+// take turns through an advisory lock file.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LockName is the lock file created in the locked directory
+const LockName = ".lock"
+
+// LockTimeout is how long Lock waits for another instance
+const LockTimeout = 5 * time.Second
+
+var ErrLocked = errors.New("locked by another fana-envy instance")
+
+// WriteFile replaces path with data atomically: readers see either the
+// old or the new content, never a mix.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp*")
+	if err != nil {
+		return err
+	}
+	// Removing is harmless once the rename went through
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Lock takes the lock of dir, waiting up to LockTimeout while another
+// instance holds it. The lock is not reentrant: code holding it must not
+// call Lock again. Call unlock to release it.
+func Lock(dir string) (unlock func(), err error) {
+	path := filepath.Join(dir, LockName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", dir, ErrLocked)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// Locked runs fn while holding the lock of dir
+func Locked(dir string, fn func() error) error {
+	unlock, err := Lock(dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fn()
+}
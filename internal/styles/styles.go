@@ -43,4 +43,9 @@ var (
 	StatusBar = lipgloss.NewStyle().
 			Background(BgDark).
 			Foreground(White)
+
+	StatusError = lipgloss.NewStyle().
+			Background(Red).
+			Foreground(White).
+			Bold(true)
 )
@@ -0,0 +1,58 @@
+package terminal
+
+import tea "github.com/charmbracelet/bubbletea"
+
+// keySequences maps special keys to the bytes an xterm sends for them
+var keySequences = map[tea.KeyType]string{
+	tea.KeyUp:        "\x1b[A",
+	tea.KeyDown:      "\x1b[B",
+	tea.KeyRight:     "\x1b[C",
+	tea.KeyLeft:      "\x1b[D",
+	tea.KeyShiftTab:  "\x1b[Z",
+	tea.KeyHome:      "\x1b[H",
+	tea.KeyEnd:       "\x1b[F",
+	tea.KeyInsert:    "\x1b[2~",
+	tea.KeyDelete:    "\x1b[3~",
+	tea.KeyPgUp:      "\x1b[5~",
+	tea.KeyPgDown:    "\x1b[6~",
+	tea.KeyCtrlUp:    "\x1b[1;5A",
+	tea.KeyCtrlDown:  "\x1b[1;5B",
+	tea.KeyCtrlRight: "\x1b[1;5C",
+	tea.KeyCtrlLeft:  "\x1b[1;5D",
+	tea.KeyF1:        "\x1bOP",
+	tea.KeyF2:        "\x1bOQ",
+	tea.KeyF3:        "\x1bOR",
+	tea.KeyF4:        "\x1bOS",
+	tea.KeyF5:        "\x1b[15~",
+	tea.KeyF6:        "\x1b[17~",
+	tea.KeyF7:        "\x1b[18~",
+	tea.KeyF8:        "\x1b[19~",
+	tea.KeyF9:        "\x1b[20~",
+	tea.KeyF10:       "\x1b[21~",
+	tea.KeyF11:       "\x1b[23~",
+	tea.KeyF12:       "\x1b[24~",
+}
+
+// KeyBytes encodes a key press the way a terminal would send it to a
+// program, for forwarding to a pseudo-terminal.
+func KeyBytes(msg tea.KeyMsg) []byte {
+	var s string
+	switch {
+	case msg.Type == tea.KeyRunes:
+		s = string(msg.Runes)
+	case msg.Type == tea.KeySpace:
+		s = " "
+	case msg.Type >= 0 && msg.Type < 32, msg.Type == 127:
+		// Control characters, including Enter, Tab, Esc and Backspace
+		s = string(rune(msg.Type))
+	default:
+		s = keySequences[msg.Type]
+	}
+	if s == "" {
+		return nil
+	}
+	if msg.Alt {
+		s = "\x1b" + s
+	}
+	return []byte(s)
+}
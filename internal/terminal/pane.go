@@ -3,10 +3,15 @@ package terminal
 import (
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/MasFana/fana-envy/internal/profile"
 	"github.com/MasFana/fana-envy/internal/styles"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
@@ -16,14 +21,29 @@ import (
 type TerminalPane struct {
 	ID           int
 	Name         string
-	Output       []string
+	Screen       *Screen
 	Input        textinput.Model
 	Viewport     viewport.Model
 	Cmd          *exec.Cmd
 	Stdin        io.WriteCloser
+	PTY          *os.File // Master side while a command runs under a pseudo-terminal
+	UsePTY       bool     // Run external commands under a pseudo-terminal
 	Running      bool
+	Dir          string       // Working directory for builtins and commands
+	GitBranch    string       // Branch checked out in Dir, if any
+	Profile      string       // Profile bound to this terminal
+	Env          *profile.Env // Resolved variables of Profile
+	BoundDir     string       // Directory whose binding switched Profile, see package binding
+	PrevProfile  string       // Profile restored when leaving BoundDir
+	DeniedDir    string       // Bound directory whose .envy was not trusted, asked again after leaving it
 	Mu           sync.Mutex
 	OriginalName string
+	Interrupted  time.Time // When ^C was last sent to a command on the pseudo-terminal
+
+	cols     int
+	rows     int
+	secrets  []string // Values masked when rendering
+	revealed bool
 }
 
 func NewTerminalPane(id int) *TerminalPane {
@@ -36,29 +56,180 @@ func NewTerminalPane(id int) *TerminalPane {
 	vp := viewport.New(60, 15)
 	vp.SetContent("")
 
+	dir, _ := os.Getwd()
+
 	return &TerminalPane{
 		ID:       id,
 		Name:     fmt.Sprintf("Term %d", id),
-		Output:   []string{},
+		Screen:   NewScreen(60, 15, styles.MaxOutput),
 		Input:    ti,
 		Viewport: vp,
+		UsePTY:   PTYSupported,
+		Dir:      dir,
+		cols:     60,
+		rows:     15,
+	}
+}
+
+// Proc is a snapshot of the command running in a pane
+type Proc struct {
+	Cmd   *exec.Cmd
+	PTY   *os.File       // Nil when the command runs without a pseudo-terminal
+	Stdin io.WriteCloser // Nil once the command's input is closed
+}
+
+// Proc returns the command running in t, or nil. Cmd, PTY, Stdin and
+// Running are set by the goroutine that runs the command, so the UI reads
+// them through here.
+func (t *TerminalPane) Proc() *Proc {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+
+	if !t.Running {
+		return nil
 	}
+	return &Proc{Cmd: t.Cmd, PTY: t.PTY, Stdin: t.Stdin}
+}
+
+// IsRunning reports whether a command runs in t
+func (t *TerminalPane) IsRunning() bool {
+	return t.Proc() != nil
 }
 
+// AddOutput prints a complete line, starting a new one first if a program
+// left the cursor mid-line.
 func (t *TerminalPane) AddOutput(line string) {
 	t.Mu.Lock()
 	defer t.Mu.Unlock()
 
-	t.Output = append(t.Output, line)
-	if len(t.Output) > styles.MaxOutput {
-		t.Output = t.Output[len(t.Output)-styles.MaxOutput:]
+	if !t.Screen.AtLineStart() {
+		t.Screen.Write([]byte("\r\n"))
+	}
+	// The emulator treats \n as a bare line feed, as terminals do
+	t.Screen.Write([]byte(strings.ReplaceAll(line, "\n", "\r\n") + "\r\n"))
+	t.refresh()
+}
+
+// Write feeds raw program output, including escape sequences, through the
+// screen emulator. Answers to terminal queries go back to the pseudo-terminal.
+func (t *TerminalPane) Write(p []byte) (int, error) {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+
+	t.Screen.Write(p)
+	if replies := t.Screen.Replies(); len(replies) > 0 && t.PTY != nil {
+		t.PTY.Write(replies)
+	}
+	t.refresh()
+	return len(p), nil
+}
+
+// Clear empties the screen and scrollback
+func (t *TerminalPane) Clear() {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+
+	t.Screen.Clear()
+	t.refresh()
+}
+
+// HasOutput reports whether anything has been printed since the last Clear
+func (t *TerminalPane) HasOutput() bool {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	return !t.Screen.Empty()
+}
+
+// Resize sets the screen size and forwards it to a running
+// pseudo-terminal so full screen programs can redraw.
+func (t *TerminalPane) Resize(cols, rows int) {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+
+	if cols == t.cols && rows == t.rows {
+		return
+	}
+	t.cols, t.rows = cols, rows
+	t.Screen.Resize(cols, rows)
+	if t.PTY != nil {
+		resizePTY(t.PTY, cols, rows)
 	}
-	t.Viewport.SetContent(strings.Join(t.Output, "\n"))
+	t.refresh()
+}
+
+// Size returns the last size passed to Resize
+func (t *TerminalPane) Size() (int, int) {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	return t.cols, t.rows
+}
+
+func (t *TerminalPane) refresh() {
+	t.Viewport.SetContent(t.render())
 	t.Viewport.GotoBottom()
 }
 
+// render draws the scrollback and screen; the cursor is only shown while a
+// program owns the pseudo-terminal. Secret values are masked unless
+// revealed.
+func (t *TerminalPane) render() string {
+	lines := t.Screen.Lines(t.PTY != nil)
+	if !t.revealed {
+		lines = profile.MaskLines(lines, t.secrets)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// AddSecrets adds values to mask in the output. Values are kept after a
+// profile switch since they may still be on screen.
+func (t *TerminalPane) AddSecrets(values ...string) {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+
+	changed := false
+	for _, v := range values {
+		if v != "" && !slices.Contains(t.secrets, v) {
+			t.secrets = append(t.secrets, v)
+			changed = true
+		}
+	}
+	if changed {
+		t.refresh()
+	}
+}
+
+// Secrets returns the values masked in the output
+func (t *TerminalPane) Secrets() []string {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	return slices.Clone(t.secrets)
+}
+
+// SetRevealed shows or masks secret values
+func (t *TerminalPane) SetRevealed(revealed bool) {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+
+	if t.revealed != revealed {
+		t.revealed = revealed
+		t.refresh()
+	}
+}
+
 func (t *TerminalPane) GetOutput() string {
 	t.Mu.Lock()
 	defer t.Mu.Unlock()
-	return strings.Join(t.Output, "\n")
+	return t.render()
+}
+
+// Path resolves p, which may start with ~, against the pane's directory
+func (t *TerminalPane) Path(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") || strings.HasPrefix(p, "~"+string(filepath.Separator)) {
+		home, _ := os.UserHomeDir()
+		p = filepath.Join(home, p[1:])
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(t.Dir, p)
+	}
+	return filepath.Clean(p)
 }
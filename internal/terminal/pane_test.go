@@ -0,0 +1,58 @@
+package terminal
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestSecretsMaskedWhenWrapped(t *testing.T) {
+	secret := strings.Repeat("Q", 50)
+	pane := NewTerminalPane(1)
+	pane.Resize(20, 10)
+	pane.AddSecrets(secret, "first\nsecond")
+	pane.AddOutput("API_KEY=" + secret)
+	pane.AddOutput("first\nsecond")
+
+	out := pane.GetOutput()
+	if strings.Contains(out, "Q") || strings.Contains(out, "first") || strings.Contains(out, "second") {
+		t.Errorf("secret shown in output:\n%s", out)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if n := len([]rune(line)); n > 20 {
+			t.Errorf("masked line %q is %d columns wide, want at most 20", line, n)
+		}
+	}
+
+	pane.SetRevealed(true)
+	if out := pane.GetOutput(); !strings.Contains(out, "QQQ") {
+		t.Errorf("secret not revealed:\n%s", out)
+	}
+}
+
+func TestProcWhileCommandEnds(t *testing.T) {
+	pane := NewTerminalPane(1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 1000 {
+			// As RunExternalCmd and the CmdDoneMsg handler do
+			pane.Mu.Lock()
+			pane.Cmd, pane.Running = &exec.Cmd{}, true
+			pane.Mu.Unlock()
+			pane.Mu.Lock()
+			pane.Cmd, pane.Running = nil, false
+			pane.Mu.Unlock()
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if proc := pane.Proc(); proc != nil && proc.Cmd == nil {
+			t.Fatal("Proc() of a running command has no Cmd")
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux && !darwin
+
+package terminal
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// PTYSupported reports whether commands can run under a pseudo-terminal
+const PTYSupported = false
+
+var errPTYUnsupported = errors.New("pseudo-terminals are not supported on this platform")
+
+func StartPTY(c *exec.Cmd, cols, rows int) (*os.File, error) {
+	return nil, errPTYUnsupported
+}
+
+func resizePTY(f *os.File, cols, rows int) error {
+	return errPTYUnsupported
+}
@@ -0,0 +1,46 @@
+//go:build linux || darwin
+
+package terminal
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// PTYSupported reports whether commands can run under a pseudo-terminal
+const PTYSupported = true
+
+// StartPTY starts c with a new pseudo-terminal as its controlling terminal
+// and stdio, and returns the master side.
+func StartPTY(c *exec.Cmd, cols, rows int) (*os.File, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	defer slave.Close()
+
+	resizePTY(master, cols, rows)
+	c.Stdin = slave
+	c.Stdout = slave
+	c.Stderr = slave
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+
+	if err := c.Start(); err != nil {
+		master.Close()
+		return nil, err
+	}
+	return master, nil
+}
+
+func resizePTY(f *os.File, cols, rows int) error {
+	if cols <= 0 || rows <= 0 {
+		return nil
+	}
+	return unix.IoctlSetWinsize(int(f.Fd()), unix.TIOCSWINSZ, &unix.Winsize{
+		Col: uint16(cols),
+		Row: uint16(rows),
+	})
+}
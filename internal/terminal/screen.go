@@ -0,0 +1,799 @@
+package terminal
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// Color is a palette index (0-255), a 24-bit RGB value tagged with
+// rgbColor, or DefaultColor.
+type Color int32
+
+const (
+	DefaultColor Color = -1
+	rgbColor     Color = 1 << 24
+)
+
+type Attr uint8
+
+const (
+	AttrBold Attr = 1 << iota
+	AttrDim
+	AttrItalic
+	AttrUnderline
+	AttrBlink
+	AttrReverse
+	AttrHidden
+	AttrStrike
+)
+
+type Style struct {
+	FG    Color
+	BG    Color
+	Attrs Attr
+}
+
+var defaultStyle = Style{FG: DefaultColor, BG: DefaultColor}
+
+// Cell is one character position. Ch is 0 in the cell right of a wide rune.
+type Cell struct {
+	Ch    rune
+	Style Style
+}
+
+type cursorState struct {
+	x, y  int
+	style Style
+}
+
+const (
+	stateGround = iota
+	stateEscape
+	stateCharset
+	stateCSI
+	stateString // OSC, DCS and friends, skipped up to BEL or ST
+	stateStringEsc
+)
+
+// Screen is a small VT100/xterm emulator: a grid of cells with a cursor,
+// scroll region, alternate screen and a scrollback of rendered lines.
+type Screen struct {
+	cols, rows int
+	grid       [][]Cell
+	scrollback []string
+	maxLines   int
+
+	x, y     int
+	style    Style
+	wrapNext bool
+	top      int
+	bottom   int
+	saved    cursorState
+	autowrap bool
+	hidden   bool // Cursor hidden by the program
+
+	mainGrid  [][]Cell // Main screen while the alternate screen is active
+	mainSaved cursorState
+
+	state   int
+	params  strings.Builder
+	pending []byte // Incomplete UTF-8 sequence from the previous Write
+	replies []byte
+}
+
+func NewScreen(cols, rows, maxLines int) *Screen {
+	s := &Screen{maxLines: maxLines}
+	s.reset(cols, rows)
+	return s
+}
+
+func (s *Screen) reset(cols, rows int) {
+	s.cols, s.rows = max(cols, 1), max(rows, 1)
+	s.grid = make([][]Cell, s.rows)
+	for i := range s.grid {
+		s.grid[i] = s.blankLine()
+	}
+	s.x, s.y = 0, 0
+	s.style = defaultStyle
+	s.wrapNext = false
+	s.top, s.bottom = 0, s.rows-1
+	s.saved = cursorState{style: defaultStyle}
+	s.autowrap = true
+	s.hidden = false
+	s.mainGrid = nil
+	s.state = stateGround
+}
+
+// Clear drops all output, including scrollback
+func (s *Screen) Clear() {
+	s.scrollback = nil
+	s.reset(s.cols, s.rows)
+}
+
+func (s *Screen) blankLine() []Cell {
+	line := make([]Cell, s.cols)
+	for i := range line {
+		line[i] = Cell{Ch: ' ', Style: defaultStyle}
+	}
+	return line
+}
+
+// Empty reports whether nothing has been written since the last Clear
+func (s *Screen) Empty() bool {
+	if len(s.scrollback) > 0 || s.x > 0 || s.y > 0 {
+		return false
+	}
+	for _, c := range s.grid[0] {
+		if c.Ch != ' ' {
+			return false
+		}
+	}
+	return true
+}
+
+// AtLineStart reports whether the cursor is in the first column
+func (s *Screen) AtLineStart() bool {
+	return s.x == 0 && !s.wrapNext
+}
+
+// AltScreen reports whether a full screen program switched to the
+// alternate screen
+func (s *Screen) AltScreen() bool {
+	return s.mainGrid != nil
+}
+
+// Replies returns and clears answers to terminal queries (cursor position,
+// device attributes) that should be written back to the program.
+func (s *Screen) Replies() []byte {
+	r := s.replies
+	s.replies = nil
+	return r
+}
+
+// Resize changes the visible size without reflowing text. Rows that no
+// longer fit above the cursor move to the scrollback.
+func (s *Screen) Resize(cols, rows int) {
+	cols, rows = max(cols, 1), max(rows, 1)
+	if cols == s.cols && rows == s.rows {
+		return
+	}
+
+	// Lines leaving the main screen go to the scrollback; the alternate
+	// screen has no history
+	resizeGrid := func(grid [][]Cell, cursorY int, history bool) ([][]Cell, int) {
+		for len(grid) > rows {
+			if cursorY > 0 {
+				if history {
+					s.pushScrollback(grid[0])
+				}
+				grid = grid[1:]
+				cursorY--
+			} else {
+				grid = grid[:len(grid)-1]
+			}
+		}
+		for i, line := range grid {
+			grid[i] = resizeLine(line, cols)
+		}
+		for len(grid) < rows {
+			grid = append(grid, s.blankLine())
+		}
+		return grid, cursorY
+	}
+
+	s.cols = cols
+	if s.mainGrid != nil {
+		s.mainGrid, s.mainSaved.y = resizeGrid(s.mainGrid, s.mainSaved.y, true)
+		s.grid, s.y = resizeGrid(s.grid, s.y, false)
+	} else {
+		s.grid, s.y = resizeGrid(s.grid, s.y, true)
+	}
+	s.rows = rows
+	s.top, s.bottom = 0, rows-1
+	s.x = min(s.x, cols-1)
+	s.y = min(s.y, rows-1)
+	// Saved cursors are restored later and must fit as well
+	s.saved.x, s.saved.y = min(s.saved.x, cols-1), min(s.saved.y, rows-1)
+	s.mainSaved.x, s.mainSaved.y = min(s.mainSaved.x, cols-1), min(s.mainSaved.y, rows-1)
+	s.wrapNext = false
+}
+
+func resizeLine(line []Cell, cols int) []Cell {
+	if len(line) >= cols {
+		return line[:cols]
+	}
+	for len(line) < cols {
+		line = append(line, Cell{Ch: ' ', Style: defaultStyle})
+	}
+	return line
+}
+
+func (s *Screen) pushScrollback(line []Cell) {
+	s.scrollback = append(s.scrollback, renderLine(line, -1))
+	if over := len(s.scrollback) - s.maxLines; s.maxLines > 0 && over > 0 {
+		s.scrollback = s.scrollback[over:]
+	}
+}
+
+// Write feeds program output through the emulator
+func (s *Screen) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(s.pending) > 0 {
+		p = append(s.pending, p...)
+		s.pending = nil
+	}
+
+	for len(p) > 0 {
+		r, size := utf8.DecodeRune(p)
+		if r == utf8.RuneError && size <= 1 && !utf8.FullRune(p) {
+			s.pending = append([]byte(nil), p...)
+			break
+		}
+		p = p[size:]
+		s.feed(r)
+	}
+	return n, nil
+}
+
+func (s *Screen) feed(r rune) {
+	switch s.state {
+	case stateEscape:
+		s.escape(r)
+		return
+	case stateCharset:
+		s.state = stateGround
+		return
+	case stateCSI:
+		if r >= 0x40 && r <= 0x7e {
+			s.state = stateGround
+			s.csi(r, s.params.String())
+			return
+		}
+		if r == 0x1b {
+			s.state = stateEscape
+			return
+		}
+		s.params.WriteRune(r)
+		return
+	case stateString:
+		switch r {
+		case 0x07:
+			s.state = stateGround
+		case 0x1b:
+			s.state = stateStringEsc
+		}
+		return
+	case stateStringEsc:
+		if r == '\\' {
+			s.state = stateGround
+		} else {
+			s.state = stateString
+		}
+		return
+	}
+
+	switch r {
+	case 0x1b:
+		s.state = stateEscape
+	case '\r':
+		s.x = 0
+		s.wrapNext = false
+	case '\n', '\v', '\f':
+		s.index()
+	case '\b':
+		if s.x > 0 {
+			s.x--
+		}
+		s.wrapNext = false
+	case '\t':
+		s.x = min((s.x/8+1)*8, s.cols-1)
+		s.wrapNext = false
+	case 0x07, 0x0e, 0x0f, 0x00, 0x7f:
+	default:
+		if r < 0x20 {
+			return
+		}
+		s.put(r)
+	}
+}
+
+func (s *Screen) put(r rune) {
+	w := runewidth.RuneWidth(r)
+	if w == 0 {
+		return
+	}
+	if s.wrapNext || s.x+w > s.cols {
+		if s.autowrap {
+			s.x = 0
+			s.index()
+		} else {
+			s.x = s.cols - w
+		}
+		s.wrapNext = false
+	}
+	if w > s.cols {
+		return
+	}
+
+	// Overwriting half of a wide rune blanks the other half
+	line := s.grid[s.y]
+	if line[s.x].Ch == 0 && s.x > 0 {
+		line[s.x-1] = Cell{Ch: ' ', Style: line[s.x-1].Style}
+	}
+	if end := s.x + w; end < s.cols && line[end].Ch == 0 {
+		line[end] = Cell{Ch: ' ', Style: line[end].Style}
+	}
+	line[s.x] = Cell{Ch: r, Style: s.style}
+	if w == 2 {
+		line[s.x+1] = Cell{Ch: 0, Style: s.style}
+	}
+	s.x += w
+	if s.x >= s.cols {
+		s.x = s.cols - 1
+		s.wrapNext = true
+	}
+}
+
+// index moves the cursor down, scrolling the region at its bottom
+func (s *Screen) index() {
+	s.wrapNext = false
+	if s.y == s.bottom {
+		s.scrollUp(1)
+	} else if s.y < s.rows-1 {
+		s.y++
+	}
+}
+
+func (s *Screen) reverseIndex() {
+	s.wrapNext = false
+	if s.y == s.top {
+		s.scrollDown(1)
+	} else if s.y > 0 {
+		s.y--
+	}
+}
+
+func (s *Screen) scrollUp(n int) {
+	for i := 0; i < n; i++ {
+		// Only lines leaving the top of the full main screen are history
+		if s.top == 0 && s.mainGrid == nil {
+			s.pushScrollback(s.grid[0])
+		}
+		copy(s.grid[s.top:s.bottom], s.grid[s.top+1:s.bottom+1])
+		s.grid[s.bottom] = s.blankLine()
+	}
+}
+
+func (s *Screen) scrollDown(n int) {
+	for i := 0; i < n; i++ {
+		copy(s.grid[s.top+1:s.bottom+1], s.grid[s.top:s.bottom])
+		s.grid[s.top] = s.blankLine()
+	}
+}
+
+func (s *Screen) escape(r rune) {
+	s.state = stateGround
+	switch r {
+	case '[':
+		s.params.Reset()
+		s.state = stateCSI
+	case ']', 'P', '_', '^', 'X':
+		s.state = stateString
+	case '(', ')', '*', '+', '#', '%':
+		s.state = stateCharset
+	case '7':
+		s.saved = cursorState{s.x, s.y, s.style}
+	case '8':
+		s.restoreCursor()
+	case 'D':
+		s.index()
+	case 'E':
+		s.x = 0
+		s.index()
+	case 'M':
+		s.reverseIndex()
+	case 'c':
+		s.Clear()
+	}
+}
+
+func (s *Screen) restoreCursor() {
+	s.x = min(s.saved.x, s.cols-1)
+	s.y = min(s.saved.y, s.rows-1)
+	s.style = s.saved.style
+	s.wrapNext = false
+}
+
+func parseParams(p string) []int {
+	if p == "" {
+		return nil
+	}
+	fields := strings.FieldsFunc(p, func(r rune) bool { return r == ';' || r == ':' })
+	nums := make([]int, 0, len(fields))
+	for _, f := range fields {
+		n, _ := strconv.Atoi(f)
+		nums = append(nums, n)
+	}
+	return nums
+}
+
+func param(nums []int, i, def int) int {
+	if i < len(nums) && nums[i] > 0 {
+		return nums[i]
+	}
+	return def
+}
+
+func (s *Screen) csi(final rune, raw string) {
+	private := ""
+	if raw != "" && strings.ContainsRune("?>=<", rune(raw[0])) {
+		private, raw = raw[:1], raw[1:]
+	}
+	// Intermediate bytes (e.g. "CSI ! p") are not needed for anything we handle
+	raw = strings.TrimRight(raw, " !\"#$%&'()*+,-./")
+	nums := parseParams(raw)
+	n := param(nums, 0, 1)
+
+	if private != "" && final != 'h' && final != 'l' {
+		if private == ">" && final == 'c' {
+			s.replies = append(s.replies, "\x1b[>0;0;0c"...)
+		}
+		return
+	}
+
+	s.wrapNext = false
+	switch final {
+	case 'A':
+		s.y = max(s.y-n, s.topLimit())
+	case 'B', 'e':
+		s.y = min(s.y+n, s.bottomLimit())
+	case 'C', 'a':
+		s.x = min(s.x+n, s.cols-1)
+	case 'D':
+		s.x = max(s.x-n, 0)
+	case 'E':
+		s.y = min(s.y+n, s.bottomLimit())
+		s.x = 0
+	case 'F':
+		s.y = max(s.y-n, s.topLimit())
+		s.x = 0
+	case 'G', '`':
+		s.x = clamp(n-1, 0, s.cols-1)
+	case 'd':
+		s.y = clamp(n-1, 0, s.rows-1)
+	case 'H', 'f':
+		s.y = clamp(param(nums, 0, 1)-1, 0, s.rows-1)
+		s.x = clamp(param(nums, 1, 1)-1, 0, s.cols-1)
+	case 'J':
+		s.eraseDisplay(param(nums, 0, 0))
+	case 'K':
+		s.eraseLine(param(nums, 0, 0))
+	case 'L':
+		if s.y >= s.top && s.y <= s.bottom {
+			top := s.top
+			s.top = s.y
+			s.scrollDown(min(n, s.bottom-s.y+1))
+			s.top = top
+		}
+	case 'M':
+		if s.y >= s.top && s.y <= s.bottom {
+			top := s.top
+			s.top = s.y
+			for i := 0; i < min(n, s.bottom-s.y+1); i++ {
+				copy(s.grid[s.top:s.bottom], s.grid[s.top+1:s.bottom+1])
+				s.grid[s.bottom] = s.blankLine()
+			}
+			s.top = top
+		}
+	case 'P':
+		line, x := s.grid[s.y], s.col()
+		n = min(n, s.cols-x)
+		copy(line[x:], line[x+n:])
+		s.fill(line[s.cols-n:])
+	case '@':
+		line, x := s.grid[s.y], s.col()
+		n = min(n, s.cols-x)
+		copy(line[x+n:], line[x:s.cols-n])
+		s.fill(line[x : x+n])
+	case 'X':
+		line, x := s.grid[s.y], s.col()
+		s.fill(line[x:min(x+n, s.cols)])
+	case 'S':
+		s.scrollUp(n)
+	case 'T':
+		s.scrollDown(n)
+	case 'm':
+		s.sgr(nums)
+	case 'r':
+		top := param(nums, 0, 1) - 1
+		bottom := param(nums, 1, s.rows) - 1
+		if top < bottom && bottom < s.rows {
+			s.top, s.bottom = top, bottom
+			s.x, s.y = 0, 0
+		}
+	case 's':
+		s.saved = cursorState{s.x, s.y, s.style}
+	case 'u':
+		s.restoreCursor()
+	case 'n':
+		switch n {
+		case 5:
+			s.replies = append(s.replies, "\x1b[0n"...)
+		case 6:
+			s.replies = append(s.replies, "\x1b["+strconv.Itoa(s.y+1)+";"+strconv.Itoa(s.x+1)+"R"...)
+		}
+	case 'c':
+		s.replies = append(s.replies, "\x1b[?1;2c"...)
+	case 'h', 'l':
+		if private == "?" {
+			for _, mode := range nums {
+				s.setMode(mode, final == 'h')
+			}
+		}
+	}
+}
+
+func (s *Screen) topLimit() int {
+	if s.y >= s.top {
+		return s.top
+	}
+	return 0
+}
+
+func (s *Screen) bottomLimit() int {
+	if s.y <= s.bottom {
+		return s.bottom
+	}
+	return s.rows - 1
+}
+
+// col is the cursor column, kept inside the line for slicing
+func (s *Screen) col() int {
+	return clamp(s.x, 0, s.cols-1)
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+// fill blanks cells using the current background, as terminals do
+func (s *Screen) fill(cells []Cell) {
+	blank := Cell{Ch: ' ', Style: Style{FG: DefaultColor, BG: s.style.BG}}
+	for i := range cells {
+		cells[i] = blank
+	}
+}
+
+func (s *Screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.eraseLine(0)
+		for y := s.y + 1; y < s.rows; y++ {
+			s.fill(s.grid[y])
+		}
+	case 1:
+		s.eraseLine(1)
+		for y := 0; y < s.y; y++ {
+			s.fill(s.grid[y])
+		}
+	case 2:
+		for y := 0; y < s.rows; y++ {
+			s.fill(s.grid[y])
+		}
+	case 3:
+		s.scrollback = nil
+	}
+}
+
+func (s *Screen) eraseLine(mode int) {
+	line, x := s.grid[s.y], s.col()
+	switch mode {
+	case 0:
+		s.fill(line[x:])
+	case 1:
+		s.fill(line[:x+1])
+	case 2:
+		s.fill(line)
+	}
+}
+
+func (s *Screen) setMode(mode int, on bool) {
+	switch mode {
+	case 7:
+		s.autowrap = on
+	case 25:
+		s.hidden = !on
+	case 47, 1047, 1049:
+		if on && s.mainGrid == nil {
+			s.mainSaved = cursorState{s.x, s.y, s.style}
+			s.mainGrid = s.grid
+			s.grid = make([][]Cell, s.rows)
+			for i := range s.grid {
+				s.grid[i] = s.blankLine()
+			}
+			s.top, s.bottom = 0, s.rows-1
+		} else if !on && s.mainGrid != nil {
+			s.grid = s.mainGrid
+			s.mainGrid = nil
+			s.top, s.bottom = 0, s.rows-1
+			if mode == 1049 {
+				s.x, s.y, s.style = min(s.mainSaved.x, s.cols-1), min(s.mainSaved.y, s.rows-1), s.mainSaved.style
+			}
+		}
+	}
+}
+
+func (s *Screen) sgr(nums []int) {
+	if len(nums) == 0 {
+		nums = []int{0}
+	}
+	for i := 0; i < len(nums); i++ {
+		switch n := nums[i]; {
+		case n == 0:
+			s.style = defaultStyle
+		case n == 1:
+			s.style.Attrs |= AttrBold
+		case n == 2:
+			s.style.Attrs |= AttrDim
+		case n == 3:
+			s.style.Attrs |= AttrItalic
+		case n == 4:
+			s.style.Attrs |= AttrUnderline
+		case n == 5 || n == 6:
+			s.style.Attrs |= AttrBlink
+		case n == 7:
+			s.style.Attrs |= AttrReverse
+		case n == 8:
+			s.style.Attrs |= AttrHidden
+		case n == 9:
+			s.style.Attrs |= AttrStrike
+		case n == 22:
+			s.style.Attrs &^= AttrBold | AttrDim
+		case n == 23:
+			s.style.Attrs &^= AttrItalic
+		case n == 24:
+			s.style.Attrs &^= AttrUnderline
+		case n == 25:
+			s.style.Attrs &^= AttrBlink
+		case n == 27:
+			s.style.Attrs &^= AttrReverse
+		case n == 28:
+			s.style.Attrs &^= AttrHidden
+		case n == 29:
+			s.style.Attrs &^= AttrStrike
+		case n >= 30 && n <= 37:
+			s.style.FG = Color(n - 30)
+		case n == 38 || n == 48:
+			c, used := extendedColor(nums[i+1:])
+			i += used
+			if n == 38 {
+				s.style.FG = c
+			} else {
+				s.style.BG = c
+			}
+		case n == 39:
+			s.style.FG = DefaultColor
+		case n >= 40 && n <= 47:
+			s.style.BG = Color(n - 40)
+		case n == 49:
+			s.style.BG = DefaultColor
+		case n >= 90 && n <= 97:
+			s.style.FG = Color(n - 90 + 8)
+		case n >= 100 && n <= 107:
+			s.style.BG = Color(n - 100 + 8)
+		}
+	}
+}
+
+// extendedColor parses the arguments after 38/48: 5;n or 2;r;g;b
+func extendedColor(args []int) (Color, int) {
+	if len(args) >= 2 && args[0] == 5 {
+		return Color(args[1] & 0xff), 2
+	}
+	if len(args) >= 4 && args[0] == 2 {
+		return rgbColor | Color((args[1]&0xff)<<16|(args[2]&0xff)<<8|args[3]&0xff), 4
+	}
+	return DefaultColor, len(args)
+}
+
+// Lines renders the scrollback followed by the screen. On the main screen
+// blank rows below the cursor are left out. cursor marks the cursor cell
+// in reverse video when true.
+func (s *Screen) Lines(cursor bool) []string {
+	last := s.rows - 1
+	if s.mainGrid == nil {
+		for last > s.y && isBlank(s.grid[last]) {
+			last--
+		}
+	}
+
+	lines := make([]string, 0, len(s.scrollback)+last+1)
+	if s.mainGrid == nil {
+		lines = append(lines, s.scrollback...)
+	}
+	for y := 0; y <= last; y++ {
+		cx := -1
+		if cursor && !s.hidden && y == s.y {
+			cx = s.x
+		}
+		lines = append(lines, renderLine(s.grid[y], cx))
+	}
+	return lines
+}
+
+func isBlank(line []Cell) bool {
+	for _, c := range line {
+		if c.Ch != ' ' || c.Style.BG != DefaultColor || c.Style.Attrs&AttrReverse != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// renderLine turns cells into text with SGR sequences, dropping trailing
+// default-styled blanks. The cell at cursorX, if any, is shown reversed.
+func renderLine(line []Cell, cursorX int) string {
+	end := len(line)
+	for end > 0 && end-1 != cursorX && line[end-1].Ch == ' ' && line[end-1].Style == defaultStyle {
+		end--
+	}
+
+	var b strings.Builder
+	current := defaultStyle
+	for x := 0; x < end; x++ {
+		c := line[x]
+		if c.Ch == 0 {
+			continue
+		}
+		style := c.Style
+		if x == cursorX {
+			style.Attrs ^= AttrReverse
+		}
+		if style != current {
+			b.WriteString(sgrSequence(style))
+			current = style
+		}
+		b.WriteRune(c.Ch)
+	}
+	if current != defaultStyle {
+		b.WriteString("\x1b[0m")
+	}
+	return b.String()
+}
+
+func sgrSequence(st Style) string {
+	codes := []string{"0"}
+	attrs := []struct {
+		attr Attr
+		code string
+	}{
+		{AttrBold, "1"}, {AttrDim, "2"}, {AttrItalic, "3"}, {AttrUnderline, "4"},
+		{AttrBlink, "5"}, {AttrReverse, "7"}, {AttrHidden, "8"}, {AttrStrike, "9"},
+	}
+	for _, a := range attrs {
+		if st.Attrs&a.attr != 0 {
+			codes = append(codes, a.code)
+		}
+	}
+	codes = appendColor(codes, st.FG, 30, 90, "38")
+	codes = appendColor(codes, st.BG, 40, 100, "48")
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+func appendColor(codes []string, c Color, base, bright int, extended string) []string {
+	switch {
+	case c == DefaultColor:
+		return codes
+	case c&rgbColor != 0:
+		return append(codes, extended, "2",
+			strconv.Itoa(int(c>>16&0xff)), strconv.Itoa(int(c>>8&0xff)), strconv.Itoa(int(c&0xff)))
+	case c < 8:
+		return append(codes, strconv.Itoa(base+int(c)))
+	case c < 16:
+		return append(codes, strconv.Itoa(bright+int(c)-8))
+	}
+	return append(codes, extended, "5", strconv.Itoa(int(c)))
+}
@@ -0,0 +1,137 @@
+package terminal
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var sgrPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// plain renders the screen without styling
+func plain(s *Screen) []string {
+	lines := s.Lines(false)
+	for i, l := range lines {
+		lines[i] = sgrPattern.ReplaceAllString(l, "")
+	}
+	return lines
+}
+
+func TestResizeClampsSavedCursors(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+	}{
+		{"alt screen", "\x1b[1;70H\x1b[?1049h", "\x1b[?1049l\x1b[P"},
+		{"alt screen insert", "\x1b[1;70H\x1b[?1049h", "\x1b[?1049l\x1b[@"},
+		{"alt screen erase", "\x1b[1;70H\x1b[?1049h", "\x1b[?1049l\x1b[X\x1b[K\x1b[1K"},
+		{"DECSC", "\x1b[20;70H\x1b7", "\x1b8\x1b[P\x1b[K"},
+		{"CSI s", "\x1b[20;70H\x1b[s", "\x1b[u\x1b[@\x1b[X"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScreen(80, 24, 100)
+			s.Write([]byte(tt.before))
+			s.Resize(40, 10)
+			s.Write([]byte(tt.after))
+			if s.x >= s.cols || s.y >= s.rows {
+				t.Errorf("cursor at %d,%d outside %dx%d", s.x, s.y, s.cols, s.rows)
+			}
+		})
+	}
+}
+
+func TestLineFeedWithoutReturn(t *testing.T) {
+	s := NewScreen(20, 5, 100)
+	s.Write([]byte("ab\ncd\r\nef"))
+	got := strings.Join(plain(s), "|")
+	if want := "ab|  cd|ef"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCSIAfterResize(t *testing.T) {
+	tests := []struct {
+		name       string
+		before     string
+		cols, rows int
+		after      string
+		want       []string
+	}{
+		{
+			name: "cursor position clamps to the new size",
+			cols: 10, rows: 3,
+			after: "\x1b[99;99HX",
+			want:  []string{"", "", "         X"},
+		},
+		{
+			name:   "scroll region resets",
+			before: "\x1b[2;5r",
+			cols:   10, rows: 4,
+			after: "1\r\n2\r\n3\r\n4\r\n5",
+			want:  []string{"1", "2", "3", "4", "5"},
+		},
+		{
+			name:   "erase line in a narrower screen",
+			before: "abcdefghij",
+			cols:   5, rows: 3,
+			after: "\x1b[1;3H\x1b[K",
+			want:  []string{"ab"},
+		},
+		{
+			name:   "insert at the right edge after shrinking",
+			before: "\x1b[1;80H",
+			cols:   10, rows: 3,
+			after: "\x1b[2@Z",
+			want:  []string{"         Z"},
+		},
+		{
+			name:   "delete characters after growing",
+			before: "hello",
+			cols:   20, rows: 3,
+			after: "\x1b[1;1H\x1b[2P",
+			want:  []string{"llo"},
+		},
+		{
+			name:   "erase more characters than are left",
+			before: "abcdef",
+			cols:   6, rows: 3,
+			after: "\x1b[1;4H\x1b[99X",
+			want:  []string{"abc"},
+		},
+		{
+			name:   "insert lines at the new bottom",
+			before: "a\r\nb\r\nc",
+			cols:   10, rows: 3,
+			after: "\x1b[3;1H\x1b[5L",
+			want:  []string{"a", "b", "c", "", ""},
+		},
+		{
+			name:   "rows dropped above the cursor go to the scrollback",
+			before: "1\r\n2\r\n3\r\n4",
+			cols:   10, rows: 2,
+			after: "\x1b[2J\x1b[HX",
+			want:  []string{"1", "2", "3", "X"},
+		},
+		{
+			name:   "alternate screen keeps its size on return",
+			before: "main\x1b[?1049hALT",
+			cols:   3, rows: 2,
+			after: "\x1b[?1049l\x1b[1;99HZ",
+			want:  []string{"maZ"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScreen(80, 24, 100)
+			s.Write([]byte(tt.before))
+			s.Resize(tt.cols, tt.rows)
+			s.Write([]byte(tt.after))
+			got := plain(s)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("lines = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
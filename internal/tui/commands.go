@@ -2,57 +2,136 @@ package tui
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/MasFana/fana-envy/internal/binding"
 	"github.com/MasFana/fana-envy/internal/config"
+	"github.com/MasFana/fana-envy/internal/diff"
+	"github.com/MasFana/fana-envy/internal/exporter"
+	"github.com/MasFana/fana-envy/internal/importer"
+	"github.com/MasFana/fana-envy/internal/merge"
+	"github.com/MasFana/fana-envy/internal/profile"
 	"github.com/MasFana/fana-envy/internal/styles"
+	"github.com/MasFana/fana-envy/internal/terminal"
 	"github.com/MasFana/fana-envy/internal/utils"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 )
 
 func (m Model) ExecuteCommand(input string) (tea.Model, tea.Cmd) {
-	parts := utils.SmartSplit(input)
+	overrides, parts := utils.SplitAssignments(utils.SmartSplit(input))
+	t := m.Terminals[m.ActiveIdx]
 	if len(parts) == 0 {
+		if len(overrides) > 0 {
+			t.AddOutput(styles.Error.Render("Use `set KEY VALUE` to change the profile, or `KEY=VALUE command` for one command"))
+		}
 		return m, nil
 	}
 
 	cmd := parts[0]
 	args := parts[1:]
-	t := m.Terminals[m.ActiveIdx]
 
 	switch cmd {
 	case "exit", "quit":
-		m.SaveState()
+		m.ExitErr = m.SaveState()
 		m.Quitting = true
 		return m, tea.Quit
 
 	case "clear", "cls":
-		t.Output = []string{}
-		t.Viewport.SetContent("")
+		t.Clear()
 		return m, nil
 
 	case "cd":
-		dir := ""
+		dir := "~"
 		if len(args) > 0 {
 			dir = args[0]
-		} else {
-			dir, _ = os.UserHomeDir()
-		}
-		if strings.HasPrefix(dir, "~") {
-			home, _ := os.UserHomeDir()
-			dir = filepath.Join(home, dir[1:])
 		}
-		if err := os.Chdir(dir); err != nil {
+		dir = t.Path(dir)
+		if info, err := os.Stat(dir); err != nil {
 			t.AddOutput(styles.Error.Render(fmt.Sprintf("cd: %v", err)))
+		} else if !info.IsDir() {
+			t.AddOutput(styles.Error.Render("cd: not a directory: " + dir))
 		} else {
-			m.UpdateGitBranch()
+			t.Dir = dir
+			UpdateGitBranch(t)
+			m.AutoSwitch(t)
+		}
+		return m, nil
+
+	case "bind":
+		envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+		if len(args) == 0 {
+			cfg := config.LoadConfig(envDir)
+			dirs := slices.Sorted(maps.Keys(cfg.DirProfiles))
+			for _, dir := range dirs {
+				t.AddOutput(dir + " → " + styles.Profile.Render(cfg.DirProfiles[dir]))
+			}
+			if b, _ := binding.Find(cfg, t.Dir); b != nil && b.Marker != "" {
+				state := "trusted"
+				if !b.Trusted(cfg) {
+					state = "not trusted"
+				}
+				t.AddOutput(b.Marker + " → " + styles.Profile.Render(b.Profile) + styles.Muted.Render(" ("+state+")"))
+			} else if len(dirs) == 0 {
+				t.AddOutput(styles.Muted.Render("No bound directories. Usage: " + binding.BindUsage))
+			}
+			return m, nil
+		}
+		name, dir := args[0], t.Dir
+		if len(args) > 1 {
+			dir = t.Path(args[1])
+		}
+		if !profile.Exists(envDir, name) {
+			t.AddOutput(styles.Error.Render("Not found: " + name))
+			return m, nil
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			t.AddOutput(styles.Error.Render("bind: not a directory: " + dir))
+			return m, nil
+		}
+		if err := binding.Bind(envDir, dir, name); err != nil {
+			t.AddOutput(styles.Error.Render("bind: " + err.Error()))
+			return m, nil
+		}
+		t.AddOutput(styles.Success.Render("✓ Bound " + dir + " to " + name))
+		for _, term := range m.Terminals {
+			m.AutoSwitch(term)
+		}
+		return m, nil
+
+	case "unbind":
+		envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+		dir := t.Dir
+		if len(args) > 0 {
+			dir = t.Path(args[0])
+		}
+		found, err := binding.Unbind(envDir, dir)
+		switch {
+		case err != nil:
+			t.AddOutput(styles.Error.Render("unbind: " + err.Error()))
+		case !found:
+			msg := "unbind: " + dir + " is not bound"
+			if _, err := os.Stat(filepath.Join(dir, binding.MarkerFile)); err == nil {
+				msg += "; remove its " + binding.MarkerFile + " file instead"
+			}
+			t.AddOutput(styles.Error.Render(msg))
+		default:
+			t.AddOutput(styles.Success.Render("✓ Unbound " + dir))
+			for _, term := range m.Terminals {
+				m.AutoSwitch(term)
+			}
 		}
 		return m, nil
 
@@ -74,52 +153,423 @@ func (m Model) ExecuteCommand(input string) (tea.Model, tea.Cmd) {
 		}
 		return m, nil
 
+	case "pty":
+		if !terminal.PTYSupported {
+			t.AddOutput(styles.Error.Render("pty: not supported on this platform"))
+			return m, nil
+		}
+		if len(args) > 0 {
+			switch args[0] {
+			case "on":
+				t.UsePTY = true
+			case "off":
+				t.UsePTY = false
+			default:
+				t.AddOutput(styles.Error.Render("Usage: pty [on|off]"))
+				return m, nil
+			}
+		}
+		state := "off"
+		if t.UsePTY {
+			state = "on"
+		}
+		t.AddOutput(styles.Success.Render("✓ Pseudo-terminal " + state + " for " + t.Name))
+		return m, nil
+
+	case "signal", "kill":
+		if len(args) == 0 || args[0] == "-l" {
+			t.AddOutput(styles.Muted.Render("Signals: " + strings.Join(utils.SignalNames, " ")))
+			return m, nil
+		}
+		name, err := utils.ParseSignal(args[0])
+		if err != nil {
+			t.AddOutput(styles.Error.Render("signal: " + err.Error()))
+			return m, nil
+		}
+		target := t
+		if len(args) > 1 {
+			if target = m.FindTerminal(args[1]); target == nil {
+				t.AddOutput(styles.Error.Render("signal: no terminal " + args[1]))
+				return m, nil
+			}
+		}
+		m.SendSignal(t, target, name)
+		return m, nil
+
 	case "pwd":
-		cwd, _ := os.Getwd()
-		t.AddOutput(styles.Path.Render(cwd))
+		t.AddOutput(styles.Path.Render(t.Dir))
 		return m, nil
 
 	case "env":
-		if len(m.EnvVars) == 0 {
+		if len(args) > 0 && (args[0] == "--child" || args[0] == "-c") {
+			mode := "inherits the host environment"
+			if t.Env.Isolated {
+				mode = "isolated: host variables limited to the allowlist"
+			}
+			t.AddOutput(styles.Muted.Render("# Environment of commands in " + t.Name + " (" + mode + ")"))
+			environ := m.BuildEnv(t, overrides)
+			t.AddSecrets(t.Env.SecretValues(environ, m.SecretPatterns)...)
+			for _, kv := range environ {
+				k, v, _ := strings.Cut(kv, "=")
+				t.AddOutput(styles.Profile.Render(k) + "=" + v)
+			}
+			return m, nil
+		}
+		if len(t.Env.Vars) == 0 {
 			t.AddOutput(styles.Muted.Render("No variables"))
 		} else {
-			keys := make([]string, 0, len(m.EnvVars))
-			for k := range m.EnvVars {
+			keys := make([]string, 0, len(t.Env.Vars))
+			for k := range t.Env.Vars {
 				keys = append(keys, k)
 			}
 			sort.Strings(keys)
 			for _, k := range keys {
-				t.AddOutput(styles.Profile.Render(k) + "=" + m.EnvVars[k])
+				line := styles.Profile.Render(k) + "=" + t.Env.Vars[k]
+				if src := t.Env.Sources[k]; src != "" && src != t.Profile {
+					line += styles.Muted.Render("  (" + src + ")")
+				}
+				t.AddOutput(line)
+			}
+		}
+		return m, nil
+
+	case "export":
+		format := "bash"
+		name := t.Profile
+		for i := 0; i < len(args); i++ {
+			switch {
+			case (args[i] == "-f" || args[i] == "--format") && i+1 < len(args):
+				i++
+				format = args[i]
+			case strings.HasPrefix(args[i], "--format="):
+				format = strings.TrimPrefix(args[i], "--format=")
+			default:
+				name = args[i]
+			}
+		}
+
+		vars := t.Env.Vars
+		if name != t.Profile {
+			envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+			if !profile.Exists(envDir, name) {
+				t.AddOutput(styles.Error.Render("Not found: " + name))
+				return m, nil
+			}
+			other := profile.Resolve(envDir, name, os.LookupEnv)
+			vars = other.Vars
+			// This pane only masks its own profile's secrets so far
+			environ := make([]string, 0, len(vars))
+			for k, v := range vars {
+				environ = append(environ, k+"="+v)
 			}
+			t.AddSecrets(other.SecretValues(environ, m.SecretPatterns)...)
+		}
+
+		out, err := exporter.Export(vars, format)
+		if err != nil {
+			t.AddOutput(styles.Error.Render("export: " + err.Error()))
+			return m, nil
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+			t.AddOutput(line)
 		}
 		return m, nil
 
+	case "import":
+		fs := flag.NewFlagSet("import", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		var opts importer.Options
+		opts.Register(fs)
+		rest, err := utils.ParseFlags(fs, args)
+		if err != nil || len(rest) < 1 || len(rest) > 2 {
+			t.AddOutput(styles.Error.Render("Usage: " + importer.Usage))
+			return m, nil
+		}
+		name := t.Profile
+		if len(rest) == 2 {
+			name = rest[1]
+		}
+
+		source := rest[0]
+		if source != importer.EnvSource {
+			source = t.Path(source)
+		}
+		vars, err := importer.Load(source, opts)
+		if err != nil {
+			t.AddOutput(styles.Error.Render("import: " + err.Error()))
+			return m, nil
+		}
+		envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+		res, err := importer.Merge(envDir, name, vars, opts.Overwrite)
+		if err != nil {
+			t.AddOutput(styles.Error.Render("import: " + err.Error()))
+			return m, nil
+		}
+
+		if res.Created {
+			t.AddOutput(styles.Success.Render("✓ Created " + name))
+			m.LoadProfiles()
+		}
+		report := func(label string, keys []string, style lipgloss.Style) {
+			if len(keys) > 0 {
+				t.AddOutput(style.Render(fmt.Sprintf("%d %s: %s", len(keys), label, strings.Join(keys, ", "))))
+			}
+		}
+		report("added", res.Added, styles.Success)
+		report("changed", res.Changed, styles.Git)
+		report("conflicting (kept, use --overwrite)", res.Conflicts, styles.Error)
+		report("unchanged", res.Unchanged, styles.Muted)
+		m.ReloadProfile(name)
+		return m, nil
+
 	case "set":
+		secret := len(args) > 0 && (args[0] == "--secret" || args[0] == "-s")
+		if secret {
+			args = args[1:]
+		}
 		if len(args) < 2 {
-			t.AddOutput(styles.Error.Render("Usage: set KEY VALUE"))
+			t.AddOutput(styles.Error.Render("Usage: set [--secret] KEY VALUE"))
 			return m, nil
 		}
 		key := args[0]
 		value := strings.Join(args[1:], " ")
-		if !utils.IsValidEnvVar(key) {
-			t.AddOutput(styles.Error.Render("Invalid variable name"))
+		envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+		set, done := profile.Set, "✓ Set "+key
+		if secret {
+			set, done = profile.SetSecret, "✓ Set "+key+" (encrypted)"
+		}
+		if err := set(envDir, t.Profile, key, value); err != nil {
+			t.AddOutput(styles.Error.Render("set: " + err.Error()))
+			return m, nil
+		}
+		m.ReloadProfile(t.Profile)
+		t.AddOutput(styles.Success.Render(done))
+		return m, nil
+
+	case "diff":
+		fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		opts := diff.Options{Patterns: m.SecretPatterns}
+		fs.BoolVar(&opts.KeysOnly, "keys-only", false, "")
+		fs.BoolVar(&opts.Reveal, "reveal", false, "")
+		rest, err := utils.ParseFlags(fs, args)
+		if err != nil || len(rest) != 2 {
+			t.AddOutput(styles.Error.Render("Usage: " + diff.Usage))
+			return m, nil
+		}
+		envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+		var sides [2]*diff.Side
+		for i, spec := range rest {
+			if sides[i], err = diff.Load(envDir, t.Dir, spec); err != nil {
+				t.AddOutput(styles.Error.Render("diff: " + err.Error()))
+				return m, nil
+			}
+		}
+		printDiff(t, sides[0], sides[1], opts)
+		return m, nil
+
+	case "merge", "copy-keys":
+		fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		var base string
+		var include []string
+		usage := merge.CopyKeysUsage
+		if cmd == "merge" {
+			fs.StringVar(&base, "base", "", "")
+			fs.Var((*importer.GlobList)(&include), "include", "")
+			usage = merge.MergeUsage
+		}
+		ours := fs.Bool("ours", false, "")
+		theirs := fs.Bool("theirs", false, "")
+		rest, err := utils.ParseFlags(fs, args)
+		if cmd == "copy-keys" && len(rest) > 2 {
+			include, rest = rest[2:], rest[:2]
+		}
+		if err != nil || len(rest) != 2 || (cmd == "copy-keys" && len(include) == 0) || (*ours && *theirs) {
+			t.AddOutput(styles.Error.Render("Usage: " + usage))
+			return m, nil
+		}
+
+		envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+		plan, err := merge.New(envDir, rest[0], rest[1], base, include)
+		if err != nil {
+			t.AddOutput(styles.Error.Render(cmd + ": " + err.Error()))
+			return m, nil
+		}
+		switch {
+		case *ours:
+			plan.Resolve(merge.KeepMine)
+		case *theirs:
+			plan.Resolve(merge.TakeTheirs)
+		}
+		if plan.Unresolved() > 0 {
+			t.AddOutput(styles.Git.Render(fmt.Sprintf("%d conflicts, resolve them in the profile pane", plan.Unresolved())))
+			m.Merge = plan
+			m.MergeIdx = 0
+			m.MergeSecrets = make(map[string]bool)
+			for _, name := range rest {
+				for _, k := range profile.Resolve(envDir, name, os.LookupEnv).Secrets {
+					m.MergeSecrets[k] = true
+				}
+			}
+			m.Mode = ModeConflict
+			return m, nil
+		}
+		m.ApplyMerge(plan)
+		return m, nil
+
+	case "history", "undo":
+		envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+		if cmd == "undo" {
+			name := t.Profile
+			if len(args) > 0 {
+				name = args[0]
+			}
+			n, err := profile.Undo(envDir, name)
+			if err != nil {
+				t.AddOutput(styles.Error.Render("undo: " + err.Error()))
+				return m, nil
+			}
+			m.ReloadProfile(name)
+			m.LoadProfiles()
+			t.AddOutput(styles.Success.Render(fmt.Sprintf("✓ Restored %s to revision %d", name, n)))
+			return m, nil
+		}
+		sub := "list"
+		if len(args) > 0 && (args[0] == "list" || args[0] == "diff" || args[0] == "restore") {
+			sub, args = args[0], args[1:]
+		}
+		name := t.Profile
+		if (sub == "list" && len(args) == 1) || (sub != "list" && len(args) == 2) {
+			name, args = args[0], args[1:]
+		}
+
+		switch {
+		case sub == "list" && len(args) == 0:
+			revs, err := profile.Revisions(envDir, name)
+			if err != nil {
+				t.AddOutput(styles.Error.Render("history: " + err.Error()))
+			} else if len(revs) == 0 {
+				t.AddOutput(styles.Muted.Render("No history for " + name))
+			}
+			for _, rev := range revs {
+				t.AddOutput(fmt.Sprintf("%3d  %s  %s", rev.N, styles.Muted.Render(rev.Time.Local().Format("2006-01-02 15:04:05")), rev.Source))
+			}
+
+		case (sub == "diff" || sub == "restore") && len(args) == 1:
+			n, err := strconv.Atoi(args[0])
+			if err != nil {
+				t.AddOutput(styles.Error.Render("history: revision must be a number"))
+				return m, nil
+			}
+			if sub == "diff" {
+				a, b, err := diff.Revision(envDir, name, n)
+				if err != nil {
+					t.AddOutput(styles.Error.Render("history: " + err.Error()))
+					return m, nil
+				}
+				printDiff(t, a, b, diff.Options{Patterns: m.SecretPatterns})
+				return m, nil
+			}
+			if err := profile.Restore(envDir, name, n); err != nil {
+				t.AddOutput(styles.Error.Render(cmd + ": " + err.Error()))
+				return m, nil
+			}
+			m.ReloadProfile(name)
+			m.LoadProfiles()
+			t.AddOutput(styles.Success.Render(fmt.Sprintf("✓ Restored %s to revision %d", name, n)))
+
+		default:
+			t.AddOutput(styles.Error.Render("Usage: " + profile.HistoryUsage))
+		}
+		return m, nil
+
+	case "check":
+		name := t.Profile
+		if len(args) > 0 {
+			name = args[0]
+		}
+		envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+		if !profile.Exists(envDir, name) {
+			t.AddOutput(styles.Error.Render("check: profile not found: " + name))
+			return m, nil
+		}
+		env := profile.Resolve(envDir, name, os.LookupEnv)
+		if len(env.Schemas) == 0 {
+			t.AddOutput(styles.Muted.Render(name + " has no # @schema"))
+			return m, nil
+		}
+		if problems := env.Check(t.Dir, buildEnv(env, t.Dir, overrides)); len(problems) > 0 {
+			for _, err := range problems {
+				t.AddOutput(styles.Error.Render("schema: " + err.Error()))
+			}
+			return m, nil
+		}
+		t.AddOutput(styles.Success.Render("✓ " + name + " matches " + strings.Join(env.Schemas, ", ")))
+		return m, nil
+
+	case "secret":
+		if len(args) != 1 || args[0] != "rotate" {
+			t.AddOutput(styles.Error.Render("Usage: secret rotate"))
+			return m, nil
+		}
+		envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+		rot, err := profile.RotateKey(envDir)
+		if err != nil {
+			t.AddOutput(styles.Error.Render("secret rotate: " + err.Error()))
 			return m, nil
 		}
-		m.EnvVars[key] = value
-		os.Setenv(key, value)
-		m.SaveProfile()
-		t.AddOutput(styles.Success.Render("✓ Set " + key))
+		total := 0
+		for name, n := range rot.Values {
+			total += n
+			m.ReloadProfile(name)
+		}
+		m.LoadEditorContent()
+		t.AddOutput(styles.Success.Render(fmt.Sprintf("✓ Rotated key, re-encrypted %d values in %d profiles and %d history revisions", total, len(rot.Values), rot.Revisions)))
+		if rot.Purged > 0 {
+			t.AddOutput(styles.Muted.Render(fmt.Sprintf("Deleted %d revisions with values of an older key", rot.Purged)))
+		}
 		return m, nil
 
 	case "unset":
+		hide := len(args) > 0 && args[0] == "--hide"
+		if hide {
+			args = args[1:]
+		}
 		if len(args) < 1 {
-			t.AddOutput(styles.Error.Render("Usage: unset KEY"))
+			t.AddOutput(styles.Error.Render("Usage: unset [--hide] KEY"))
+			return m, nil
+		}
+		key := args[0]
+		envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+		if _, err := profile.Unset(envDir, t.Profile, key); err != nil {
+			t.AddOutput(styles.Error.Render("unset: " + err.Error()))
 			return m, nil
 		}
-		delete(m.EnvVars, args[0])
-		os.Unsetenv(args[0])
-		m.SaveProfile()
-		t.AddOutput(styles.Success.Render("✓ Unset " + args[0]))
+		m.ReloadProfile(t.Profile)
+
+		// A parent's value would take over, so hide it. Hiding the host's or
+		// an injected default needs --hide.
+		_, inherited := t.Env.Vars[key]
+		fromHost := !inherited && slices.ContainsFunc(m.BuildEnv(t, nil), func(kv string) bool { return strings.HasPrefix(kv, key+"=") })
+		if inherited || hide && fromHost {
+			if err := profile.UnsetInherited(envDir, t.Profile, key); err != nil {
+				t.AddOutput(styles.Error.Render("unset: " + err.Error()))
+				return m, nil
+			}
+			m.ReloadProfile(t.Profile)
+		}
+		switch {
+		case inherited:
+			t.AddOutput(styles.Success.Render("✓ Unset " + key + " (added @unset to hide the value inherited through @extends)"))
+		case fromHost && hide:
+			t.AddOutput(styles.Success.Render("✓ Unset " + key + " (added @unset to hide the host's value)"))
+		case fromHost:
+			t.AddOutput(styles.Success.Render("✓ Unset " + key))
+			t.AddOutput(styles.Muted.Render("Commands still get " + key + " from the host; `unset --hide " + key + "` drops it"))
+		default:
+			t.AddOutput(styles.Success.Render("✓ Unset " + key))
+		}
 		return m, nil
 
 	case "switch":
@@ -129,15 +579,15 @@ func (m Model) ExecuteCommand(input string) (tea.Model, tea.Cmd) {
 		}
 		name := args[0]
 		envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
-		path := filepath.Join(envDir, name+".env")
-		if _, err := os.Stat(path); os.IsNotExist(err) {
+		if !profile.Exists(envDir, name) {
 			t.AddOutput(styles.Error.Render("Not found: " + name))
 			return m, nil
 		}
-		m.LoadProfile(path)
-		m.CurrentProfile = name
-		config.SaveConfig(envDir, m.CurrentProfile)
-		t.AddOutput(styles.Success.Render("✓ Switched to " + name))
+		m.LoadProfile(t, name)
+		if err := config.SaveConfig(envDir, name); err != nil {
+			m.Fail("Config not saved", err)
+		}
+		t.AddOutput(styles.Success.Render("✓ Switched " + t.Name + " to " + name))
 		return m, nil
 
 	case "new":
@@ -146,18 +596,11 @@ func (m Model) ExecuteCommand(input string) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 		name := args[0]
-		if !utils.IsValidProfileName(name) {
-			t.AddOutput(styles.Error.Render("Invalid name"))
-			return m, nil
-		}
 		envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
-		path := filepath.Join(envDir, name+".env")
-		if _, err := os.Stat(path); err == nil {
-			t.AddOutput(styles.Error.Render("Already exists"))
+		if err := profile.Create(envDir, name); err != nil {
+			t.AddOutput(styles.Error.Render("new: " + err.Error()))
 			return m, nil
 		}
-		content := fmt.Sprintf("# %s\n# Created: %s\n", name, time.Now().Format("2006-01-02"))
-		os.WriteFile(path, []byte(content), 0644)
 		m.LoadProfiles()
 		t.AddOutput(styles.Success.Render("✓ Created " + name))
 		return m, nil
@@ -169,23 +612,82 @@ func (m Model) ExecuteCommand(input string) (tea.Model, tea.Cmd) {
 
 	t.OriginalName = t.Name
 	t.Name = cmd
-	return m, m.RunExternalCmd(t.ID, cmd, args)
+	return m, m.RunExternalCmd(t.ID, cmd, args, overrides)
 }
 
-func (m *Model) RunExternalCmd(termID int, name string, args []string) tea.Cmd {
+// printDiff prints the differences between two sides in colors: removed
+// keys red, added green and changed yellow.
+func printDiff(t *terminal.TerminalPane, a, b *diff.Side, opts diff.Options) {
+	res := diff.Compare(a, b)
+	opStyles := map[diff.Op]lipgloss.Style{'-': styles.Error, '+': styles.Success, '~': styles.Git}
+	for _, l := range res.Lines(a, b, opts) {
+		t.AddOutput(opStyles[l.Op].Render(string(l.Op) + " " + l.Text))
+	}
+	t.AddOutput(styles.Muted.Render(res.Summary(a, b)))
+}
+
+// RunExternalCmd starts a program in the terminal with termID. overrides
+// are applied on top of the terminal's profile for this command only.
+func (m *Model) RunExternalCmd(termID int, name string, args []string, overrides map[string]string) tea.Cmd {
 	return func() tea.Msg {
 		for _, t := range m.Terminals {
 			if t.ID == termID {
 				c := exec.Command(name, args...)
-				env := m.BuildEnv()
-				env = append(env, "PYTHONUNBUFFERED=1")
-				env = append(env, "FORCE_COLOR=1")
-				env = append(env, "CLICOLOR_FORCE=1")
-				c.Env = env
+				c.Dir = t.Dir
+				environ, fetched, err := m.Secrets.Environ(m.BuildEnv(t, overrides), t.Env.Vars, t.Dir)
+				if err != nil {
+					for _, line := range strings.Split(err.Error(), "\n") {
+						t.AddOutput(styles.Error.Render("secret: " + line))
+					}
+					return CmdDoneMsg{termID, nil}
+				}
+				c.Env = environ
+				t.AddSecrets(fetched...)
+				t.AddSecrets(t.Env.SecretValues(c.Env, m.SecretPatterns)...)
+				if !m.CheckSchema(t, t.Env, t.Dir, environ) {
+					t.AddOutput(styles.Error.Render("✗ Not started: " + t.Profile + " is @strict and does not match its schema"))
+					return CmdDoneMsg{termID, nil}
+				}
+
+				if t.UsePTY && terminal.PTYSupported {
+					cols, rows := t.Size()
+					ptmx, err := terminal.StartPTY(c, cols, rows)
+					if err != nil {
+						return CmdDoneMsg{termID, err}
+					}
+
+					t.Mu.Lock()
+					t.Cmd = c
+					t.PTY = ptmx
+					t.Stdin = ptmx
+					t.Running = true
+					t.Mu.Unlock()
+
+					copied := make(chan struct{})
+					go func() {
+						io.Copy(t, ptmx)
+						close(copied)
+					}()
+
+					err = c.Wait()
+					// Background children may keep the terminal open; don't wait on them
+					select {
+					case <-copied:
+					case <-time.After(200 * time.Millisecond):
+					}
+					ptmx.Close()
+
+					t.Mu.Lock()
+					t.PTY = nil
+					t.Stdin = nil
+					t.Mu.Unlock()
+					return CmdDoneMsg{termID, err}
+				}
 
 				stdout, _ := c.StdoutPipe()
 				stderr, _ := c.StderrPipe()
 				stdin, _ := c.StdinPipe()
+				utils.SetProcessGroup(c)
 
 				t.Mu.Lock()
 				t.Cmd = c
@@ -219,7 +721,7 @@ func (m *Model) RunExternalCmd(termID int, name string, args []string) tea.Cmd {
 					}
 				}()
 
-				err := c.Wait()
+				err = c.Wait()
 				return CmdDoneMsg{termID, err}
 			}
 		}
@@ -231,6 +733,7 @@ func (m Model) GenerateCompletions(input string) ([]string, string) {
 	if input == "" {
 		return nil, ""
 	}
+	t := m.Terminals[m.ActiveIdx]
 
 	var candidates []string
 	seen := make(map[string]bool)
@@ -243,7 +746,7 @@ func (m Model) GenerateCompletions(input string) ([]string, string) {
 
 	if !strings.Contains(input, " ") {
 		start := input
-		cmds := []string{"help", "env", "set", "unset", "switch", "new", "open", "cd", "exit", "quit", "clear", "cls"}
+		cmds := []string{"help", "env", "export", "import", "set", "unset", "secret", "check", "diff", "merge", "copy-keys", "history", "undo", "switch", "bind", "unbind", "new", "open", "pty", "signal", "cd", "exit", "quit", "clear", "cls"}
 		for _, cmd := range cmds {
 			if strings.HasPrefix(cmd, start) {
 				add(cmd)
@@ -279,21 +782,20 @@ func (m Model) GenerateCompletions(input string) ([]string, string) {
 		}
 
 		switch cmd {
-		case "switch":
+		case "switch", "export":
 			for _, p := range m.Profiles {
 				if strings.HasPrefix(p, lastArg) {
 					add(prefix + p)
 				}
 			}
 		case "unset":
-			for k := range m.EnvVars {
+			for k := range t.Env.Vars {
 				if strings.HasPrefix(k, lastArg) {
 					add(prefix + k)
 				}
 			}
 		case "cd":
-			cwd, _ := os.Getwd()
-			entries, _ := os.ReadDir(cwd)
+			entries, _ := os.ReadDir(t.Dir)
 			for _, e := range entries {
 				if e.IsDir() && strings.HasPrefix(e.Name(), lastArg) {
 					add(prefix + e.Name())
@@ -301,8 +803,7 @@ func (m Model) GenerateCompletions(input string) ([]string, string) {
 			}
 		}
 
-		cwd, _ := os.Getwd()
-		entries, _ := os.ReadDir(cwd)
+		entries, _ := os.ReadDir(t.Dir)
 		for _, e := range entries {
 			if strings.HasPrefix(e.Name(), lastArg) {
 				add(prefix + e.Name())
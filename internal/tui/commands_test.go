@@ -0,0 +1,66 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MasFana/fana-envy/internal/config"
+	"github.com/MasFana/fana-envy/internal/utils"
+)
+
+func TestExportOtherProfileMasksSecrets(t *testing.T) {
+	m := InitialModel()
+	envDir := filepath.Join(utils.GetExecutableDir(), config.EnvFolderName)
+	defer os.RemoveAll(envDir)
+
+	secret := "s3cr3t-from-staging"
+	if err := os.WriteFile(filepath.Join(envDir, "staging.env"), []byte("API_KEY="+secret+"\nPORT=80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m.Width, m.Height = 120, 40
+	m.UpdateViewportSizes()
+
+	model, _ := m.ExecuteCommand("export staging")
+	out := model.(Model).Terminals[m.ActiveIdx].GetOutput()
+	if strings.Contains(out, secret) {
+		t.Errorf("secret of another profile printed:\n%s", out)
+	}
+	if !strings.Contains(out, "PORT='80'") {
+		t.Errorf("export output missing:\n%s", out)
+	}
+}
+
+func TestUnsetHidesOnlyParentValues(t *testing.T) {
+	m := InitialModel()
+	envDir := filepath.Join(utils.GetExecutableDir(), config.EnvFolderName)
+	defer os.RemoveAll(envDir)
+
+	files := map[string]string{
+		"base": "REGION=eu\n",
+		"dev":  "# @extends base\nREGION=us\nPATH=/opt/bin\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(envDir, name+".env"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pane := m.Terminals[m.ActiveIdx]
+	m.LoadProfile(pane, "dev")
+
+	for _, cmd := range []string{"unset REGION", "unset PATH"} {
+		model, _ := m.ExecuteCommand(cmd)
+		m = model.(Model)
+	}
+	got, err := os.ReadFile(filepath.Join(envDir, "dev.env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# @extends base\n# @unset REGION\n"; string(got) != want {
+		t.Errorf("dev.env = %q, want %q", got, want)
+	}
+	if out := pane.GetOutput(); !strings.Contains(out, "unset --hide PATH") {
+		t.Errorf("host value of PATH not reported:\n%s", out)
+	}
+}
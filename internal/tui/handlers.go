@@ -2,13 +2,15 @@ package tui
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
+	"github.com/MasFana/fana-envy/internal/binding"
 	"github.com/MasFana/fana-envy/internal/config"
+	"github.com/MasFana/fana-envy/internal/merge"
+	"github.com/MasFana/fana-envy/internal/profile"
 	"github.com/MasFana/fana-envy/internal/styles"
+	"github.com/MasFana/fana-envy/internal/terminal"
 	"github.com/MasFana/fana-envy/internal/utils"
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -16,14 +18,23 @@ import (
 func (m Model) handleTerminalKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	t := m.Terminals[m.ActiveIdx]
 
+	// Programs on a pseudo-terminal read raw keys and echo them themselves
+	proc := t.Proc()
+	if proc != nil && proc.PTY != nil {
+		if b := terminal.KeyBytes(msg); b != nil {
+			proc.PTY.Write(b)
+		}
+		return m, nil
+	}
+
 	switch msg.Type {
 	case tea.KeyEnter:
 		// Check if running
-		if t.Running {
-			if t.Stdin != nil {
+		if proc != nil {
+			if proc.Stdin != nil {
 				// Pass to stdin
 				inputLine := t.Input.Value() + "\n"
-				t.Stdin.Write([]byte(inputLine))
+				proc.Stdin.Write([]byte(inputLine))
 				prompt := m.buildPromptText()
 				t.AddOutput(prompt + t.Input.Value()) // Echo
 				t.Input.SetValue("")
@@ -40,7 +51,7 @@ func (m Model) handleTerminalKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		prompt := m.buildPromptText()
 
 		// Add separator before command if not first
-		if len(t.Output) > 0 {
+		if t.HasOutput() {
 			width := t.Viewport.Width
 			sep := strings.Repeat("┈", width)
 			t.AddOutput(styles.Muted.Render(sep))
@@ -53,7 +64,9 @@ func (m Model) handleTerminalKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.History = append(m.History, input)
 		}
 		m.HistoryIdx = len(m.History)
-		utils.SaveHistory(m.ConfigPath, m.History)
+		if err := utils.AppendHistory(m.ConfigPath, input); err != nil {
+			m.Fail("History not saved", err)
+		}
 
 		t.Input.SetValue("")
 
@@ -139,12 +152,14 @@ func (m Model) handleProfileKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	case "enter":
 		if len(m.Profiles) > 0 {
-			m.CurrentProfile = m.Profiles[m.SelectedIdx]
+			name := m.Profiles[m.SelectedIdx]
 			envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
-			m.LoadProfile(filepath.Join(envDir, m.CurrentProfile+".env"))
-			config.SaveConfig(envDir, m.CurrentProfile)
 			t := m.Terminals[m.ActiveIdx]
-			t.AddOutput(styles.Success.Render("✓ Switched to " + m.CurrentProfile))
+			m.LoadProfile(t, name)
+			if err := config.SaveConfig(envDir, name); err != nil {
+				m.Fail("Config not saved", err)
+			}
+			t.AddOutput(styles.Success.Render("✓ Switched " + t.Name + " to " + name))
 			m.Mode = ModeTerminal
 		}
 		return m, nil
@@ -162,10 +177,10 @@ func (m Model) handleProfileKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			name := m.Profiles[m.SelectedIdx]
 			t := m.Terminals[m.ActiveIdx]
 
-			switch name {
-			case m.CurrentProfile:
-				t.AddOutput(styles.Error.Render("Cannot delete active profile"))
-			case "default":
+			switch {
+			case m.ProfileInUse(name):
+				t.AddOutput(styles.Error.Render("Cannot delete a profile in use by a terminal"))
+			case name == profile.DefaultName:
 				t.AddOutput(styles.Error.Render("Cannot delete default"))
 			default:
 				m.Mode = ModeInput
@@ -207,6 +222,15 @@ func (m Model) handleProfileKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func (m Model) handleInputKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch m.InputPurpose {
+	case "signal":
+		return m.handleSignalKey(msg)
+	case "merge_edit":
+		return m.handleMergeEditKey(msg)
+	case "trust":
+		return m.handleTrustKey(msg)
+	}
+
 	switch msg.Type {
 	case tea.KeyEnter:
 		value := strings.TrimSpace(m.InputModel.Value())
@@ -216,19 +240,19 @@ func (m Model) handleInputKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			if value == "" {
 				return m, nil
 			}
-			if !utils.IsValidProfileName(value) {
+			envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+			err := profile.Create(envDir, value)
+			switch {
+			case err == profile.ErrInvalidName:
 				m.InputPurpose = "error"
 				m.InputModel.SetValue("Invalid Name")
 				return m, nil
-			}
-
-			envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
-			path := filepath.Join(envDir, value+".env")
-			if _, err := os.Stat(path); err == nil {
-				// Exists
-			} else {
-				content := fmt.Sprintf("# %s\n# Created: %s\n", value, time.Now().Format("2006-01-02"))
-				os.WriteFile(path, []byte(content), 0644)
+			case err != nil && err != profile.ErrExists:
+				// An existing profile is simply opened
+				m.Fail("Could not create "+value, err)
+				m.Mode = ModeProfiles
+				m.InputModel.Blur()
+				return m, nil
 			}
 			m.LoadProfiles()
 
@@ -248,9 +272,11 @@ func (m Model) handleInputKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		case "delete":
 			if strings.ToLower(value) == "y" || strings.ToLower(value) == "yes" {
 				name := m.Profiles[m.SelectedIdx]
-				if name != m.CurrentProfile && name != "default" {
+				if !m.ProfileInUse(name) {
 					envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
-					os.Remove(filepath.Join(envDir, name+".env"))
+					if err := profile.Delete(envDir, name); err != nil {
+						m.Fail("Could not delete "+name, err)
+					}
 					m.LoadProfiles()
 					if m.SelectedIdx >= len(m.Profiles) {
 						m.SelectedIdx = len(m.Profiles) - 1
@@ -266,10 +292,21 @@ func (m Model) handleInputKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 		case "confirm_save":
 			if strings.ToLower(value) == "y" || strings.ToLower(value) == "yes" {
-				m.SaveEditorContent()
+				if !m.SaveEditorContent() {
+					// Back to the editor to read the warning
+					m.Mode = ModeEditor
+					m.InputModel.Blur()
+					m.Editor.Focus()
+					return m, nil
+				}
 				m.Mode = ModeProfiles
 			} else if strings.ToLower(value) == "n" || strings.ToLower(value) == "no" {
-				m.Editor.SetValue(m.OriginalContent)
+				if m.EditorStale {
+					m.LoadEditorContent()
+				} else {
+					m.Editor.SetValue(m.OriginalContent)
+					m.SyncMasked()
+				}
 				m.Mode = ModeProfiles
 			}
 		}
@@ -342,9 +379,13 @@ func (m Model) handleEditorKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.FilenameInput, cmd = m.FilenameInput.Update(msg)
 		return m, cmd
 	} else {
+		line := m.Editor.Line()
+		if m.Masking() {
+			line = m.MaskedView.Line()
+		}
 		switch msg.String() {
 		case "up":
-			if m.Editor.Line() == 0 {
+			if line == 0 {
 				m.HeaderFocus = true
 				m.Editor.Blur()
 				m.FilenameInput.Focus()
@@ -352,8 +393,193 @@ func (m Model) handleEditorKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+		if m.Masking() {
+			// The masked copy only scrolls; editing it would save the masks
+			switch msg.String() {
+			case "up", "down", "left", "right", "pgup", "pgdown", "home", "end":
+				var cmd tea.Cmd
+				m.MaskedView, cmd = m.MaskedView.Update(msg)
+				return m, cmd
+			}
+			m.Warn("Secrets are masked; press Ctrl+R to reveal and edit them")
+			return m, nil
+		}
+
 		var cmd tea.Cmd
 		m.Editor, cmd = m.Editor.Update(msg)
+		if !m.Revealed {
+			// A secret typed in is masked as soon as it has a value
+			m.SyncMasked()
+		}
 		return m, cmd
 	}
 }
+
+func (m Model) handleSignalKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyUp:
+		if m.SignalIdx > 0 {
+			m.SignalIdx--
+		}
+		return m, nil
+
+	case tea.KeyDown:
+		if m.SignalIdx < len(utils.SignalNames)-1 {
+			m.SignalIdx++
+		}
+		return m, nil
+
+	case tea.KeyEnter:
+		name := utils.SignalNames[m.SignalIdx]
+		out := m.Terminals[m.ActiveIdx]
+		if typed := m.InputModel.Value(); strings.TrimSpace(typed) != "" {
+			var err error
+			if name, err = utils.ParseSignal(typed); err != nil {
+				out.AddOutput(styles.Error.Render("signal: " + err.Error()))
+				name = ""
+			}
+		}
+		if target := m.FindTerminal(fmt.Sprint(m.SignalTarget)); target != nil && name != "" {
+			m.SendSignal(out, target, name)
+		}
+		m.Mode = ModeTerminal
+		m.InputModel.Blur()
+		return m, nil
+
+	case tea.KeyEsc:
+		m.Mode = ModeTerminal
+		m.InputModel.Blur()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.InputModel, cmd = m.InputModel.Update(msg)
+	return m, cmd
+}
+
+func (m Model) handleConflictKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	plan := m.Merge
+	c := plan.Conflicts[m.MergeIdx]
+
+	// Deciding moves on to the next conflict
+	decide := func(choice merge.Resolution) {
+		c.Choice = choice
+		if m.MergeIdx < len(plan.Conflicts)-1 {
+			m.MergeIdx++
+		}
+	}
+
+	switch msg.String() {
+	case "up", "k":
+		if m.MergeIdx > 0 {
+			m.MergeIdx--
+		}
+	case "down", "j":
+		if m.MergeIdx < len(plan.Conflicts)-1 {
+			m.MergeIdx++
+		}
+	case "m":
+		decide(merge.KeepMine)
+	case "t":
+		decide(merge.TakeTheirs)
+	case "M":
+		plan.Resolve(merge.KeepMine)
+	case "T":
+		plan.Resolve(merge.TakeTheirs)
+	case "e":
+		value := ""
+		switch {
+		case c.Choice == merge.Edited:
+			value = c.Value
+		case c.Theirs != nil:
+			value = c.Theirs.Value
+		case c.Mine != nil:
+			value = c.Mine.Value
+		}
+		m.Mode = ModeInput
+		m.InputPurpose = "merge_edit"
+		m.InputModel.Placeholder = "Value for " + c.Key
+		m.InputModel.SetValue(value)
+		m.InputModel.Focus()
+	case "enter":
+		for i, c := range plan.Conflicts {
+			if c.Choice == merge.Unresolved {
+				m.MergeIdx = i
+				return m, nil
+			}
+		}
+		m.ApplyMerge(plan)
+		m.Merge = nil
+		m.Mode = ModeTerminal
+	case "esc":
+		m.Terminals[m.ActiveIdx].AddOutput(styles.Muted.Render("Merge cancelled, nothing written"))
+		m.Merge = nil
+		m.Mode = ModeTerminal
+	}
+	return m, nil
+}
+
+// handleTrustKey answers whether an .envy file may switch profiles. A
+// refusal holds until the terminal leaves the directory.
+func (m Model) handleTrustKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var t *terminal.TerminalPane
+	for _, term := range m.Terminals {
+		if term.ID == m.TrustTerm {
+			t = term
+		}
+	}
+
+	switch msg.Type {
+	case tea.KeyEnter, tea.KeyEsc:
+		b := m.Trust
+		answer := strings.ToLower(strings.TrimSpace(m.InputModel.Value()))
+		yes := msg.Type == tea.KeyEnter && (answer == "y" || answer == "yes")
+		if msg.Type == tea.KeyEnter && !yes && answer != "n" && answer != "no" {
+			return m, nil
+		}
+		m.Trust = nil
+		m.Mode = ModeTerminal
+		m.InputModel.Blur()
+		if t == nil {
+			return m, nil
+		}
+		if !yes {
+			t.DeniedDir = b.Dir
+			t.AddOutput(styles.Muted.Render("Not switching to " + b.Profile + " in " + b.Dir))
+			return m, nil
+		}
+		envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+		if err := binding.Trust(envDir, b); err != nil {
+			m.Fail("Config not saved", err)
+		}
+		m.enterBinding(t, b)
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.InputModel, cmd = m.InputModel.Update(msg)
+	return m, cmd
+}
+
+func (m Model) handleMergeEditKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		c := m.Merge.Conflicts[m.MergeIdx]
+		c.Choice, c.Value = merge.Edited, m.InputModel.Value()
+		if m.MergeIdx < len(m.Merge.Conflicts)-1 {
+			m.MergeIdx++
+		}
+		m.Mode = ModeConflict
+		m.InputModel.Blur()
+		return m, nil
+
+	case tea.KeyEsc:
+		m.Mode = ModeConflict
+		m.InputModel.Blur()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.InputModel, cmd = m.InputModel.Update(msg)
+	return m, cmd
+}
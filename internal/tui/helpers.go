@@ -1,15 +1,24 @@
 package tui
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"sort"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/MasFana/fana-envy/internal/binding"
 	"github.com/MasFana/fana-envy/internal/config"
+	"github.com/MasFana/fana-envy/internal/dotenv"
+	"github.com/MasFana/fana-envy/internal/merge"
+	"github.com/MasFana/fana-envy/internal/profile"
 	"github.com/MasFana/fana-envy/internal/styles"
+	"github.com/MasFana/fana-envy/internal/terminal"
 	"github.com/MasFana/fana-envy/internal/utils"
+	tea "github.com/charmbracelet/bubbletea"
 )
 
 func (m *Model) UpdateViewportSizes() {
@@ -28,6 +37,7 @@ func (m *Model) UpdateViewportSizes() {
 		t.Viewport.Width = paneWidth
 		t.Viewport.Height = contentHeight - 4
 		t.Input.Width = paneWidth - 20
+		t.Resize(t.Viewport.Width, t.Viewport.Height)
 	}
 
 	editorH := contentHeight - 4
@@ -36,21 +46,19 @@ func (m *Model) UpdateViewportSizes() {
 	}
 	m.Editor.SetWidth(paneWidth - 4)
 	m.Editor.SetHeight(editorH)
+	m.MaskedView.SetWidth(paneWidth - 4)
+	m.MaskedView.SetHeight(editorH)
 }
 
 func (m *Model) LoadProfiles() {
-	m.Profiles = []string{}
 	envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
-	files, _ := os.ReadDir(envDir)
-	for _, f := range files {
-		if !f.IsDir() && strings.HasSuffix(f.Name(), ".env") {
-			m.Profiles = append(m.Profiles, strings.TrimSuffix(f.Name(), ".env"))
-		}
+	m.Profiles, _ = profile.List(envDir)
+	if m.Profiles == nil {
+		m.Profiles = []string{}
 	}
-	sort.Strings(m.Profiles)
 
 	for i, p := range m.Profiles {
-		if p == m.CurrentProfile {
+		if p == m.ActiveProfile() {
 			m.SelectedIdx = i
 			break
 		}
@@ -60,6 +68,7 @@ func (m *Model) LoadProfiles() {
 }
 
 func (m *Model) LoadEditorContent() {
+	defer m.SyncMasked()
 	if len(m.Profiles) == 0 || m.SelectedIdx >= len(m.Profiles) {
 		m.Editor.SetValue("No profiles found")
 		return
@@ -75,136 +84,381 @@ func (m *Model) LoadEditorContent() {
 
 	m.Editor.SetValue(string(content))
 	m.OriginalContent = string(content)
+	m.EditorStale, m.Overwrite = false, ""
 }
 
-func (m *Model) TryRenameProfile(newName string) {
-	if !utils.IsValidProfileName(newName) {
+// watchEvery is how often envs/ is checked for edits made elsewhere
+const watchEvery = time.Second
+
+func watch() tea.Cmd {
+	return tea.Tick(watchEvery, func(time.Time) tea.Msg { return WatchMsg{} })
+}
+
+// CheckEnvDir reloads the profiles changed on disk since the last check by
+// an editor, another instance or a script. Unsaved edits in the editor are
+// kept; saving them then asks before overwriting the file.
+func (m *Model) CheckEnvDir() {
+	envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+	stamps, err := profile.Stamps(envDir)
+	if err != nil {
 		return
 	}
-	if len(m.Profiles) == 0 {
+	changed := profile.Changed(envDir, m.Watched, stamps)
+	m.Watched = stamps
+	if len(changed) == 0 {
 		return
 	}
+	slices.Sort(changed)
 
-	oldName := m.Profiles[m.SelectedIdx]
-	if oldName == "default" {
+	selected := ""
+	if m.SelectedIdx < len(m.Profiles) {
+		selected = m.Profiles[m.SelectedIdx]
+	}
+	dirty := m.Editor.Value() != m.OriginalContent
+
+	t := m.Terminals[m.ActiveIdx]
+	for _, name := range changed {
+		if _, ok := stamps[name]; !ok {
+			t.AddOutput(styles.Muted.Render("↻ " + name + ".env was removed on disk"))
+			continue
+		}
+		t.AddOutput(styles.Muted.Render("↻ " + name + ".env changed on disk, reloaded"))
+		m.ReloadProfile(name)
+	}
+
+	m.Profiles, _ = profile.List(envDir)
+	if m.Profiles == nil {
+		m.Profiles = []string{}
+	}
+	if dirty && !slices.Contains(m.Profiles, selected) {
+		// Keep the edits of a removed file; saving recreates it
+		m.Profiles = append(m.Profiles, selected)
+		slices.Sort(m.Profiles)
+	}
+	if i := slices.Index(m.Profiles, selected); i >= 0 {
+		m.SelectedIdx = i
+	} else if m.SelectedIdx >= len(m.Profiles) {
+		m.SelectedIdx = max(len(m.Profiles)-1, 0)
+	}
+
+	switch {
+	case !slices.Contains(changed, selected):
+	case !dirty:
+		m.LoadEditorContent()
+	default:
+		m.EditorStale = true
+		m.Warn(selected + ".env changed on disk; saving asks before overwriting it")
+	}
+}
+
+func (m *Model) TryRenameProfile(newName string) {
+	if len(m.Profiles) == 0 {
 		return
 	}
 
+	oldName := m.Profiles[m.SelectedIdx]
 	envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
-	oldPath := filepath.Join(envDir, oldName+".env")
-	newPath := filepath.Join(envDir, newName+".env")
-
-	if _, err := os.Stat(newPath); err == nil {
+	if err := profile.Rename(envDir, oldName, newName); err != nil {
+		t := m.Terminals[m.ActiveIdx]
+		t.AddOutput(styles.Error.Render("Rename failed: " + err.Error()))
 		return
 	}
 
-	err := os.Rename(oldPath, newPath)
-	if err == nil {
-		m.LoadProfiles()
-		if m.CurrentProfile == oldName {
-			m.CurrentProfile = newName
-			config.SaveConfig(envDir, m.CurrentProfile) // Fix: Pass string, not Model
+	for _, t := range m.Terminals {
+		if t.Profile == oldName {
+			m.LoadProfile(t, newName)
+		}
+	}
+	m.LoadProfiles()
+	if config.LoadConfig(envDir).LastProfile == oldName {
+		if err := config.SaveConfig(envDir, newName); err != nil {
+			m.Fail("Config not saved", err)
 		}
 	}
 }
 
-func (m *Model) SaveEditorContent() {
+// SaveEditorContent writes the editor to its profile and reports whether
+// it did. A file changed on disk since it was loaded is only overwritten
+// when saving a second time.
+func (m *Model) SaveEditorContent() bool {
 	if len(m.Profiles) > 0 {
 		name := m.Profiles[m.SelectedIdx]
 		envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
-		path := filepath.Join(envDir, name+".env")
 		content := m.Editor.Value()
-		os.WriteFile(path, []byte(content), 0644)
 
-		if name == m.CurrentProfile {
-			m.LoadProfile(path)
+		// Encrypt `KEY=encrypt:value` entries before they touch the disk
+		if doc, err := dotenv.Parse(content); err == nil {
+			n, err := profile.EncryptMarked(envDir, doc)
+			if err != nil {
+				m.Fail("Not saved", err)
+				return false
+			}
+			if n > 0 {
+				content = doc.String()
+				m.Editor.SetValue(content)
+				m.SyncMasked()
+			}
+		}
+
+		var err error
+		if m.Overwrite == name {
+			err = profile.Write(envDir, name, content, "editor")
+		} else {
+			err = profile.WriteIfUnchanged(envDir, name, m.OriginalContent, content, "editor")
+		}
+		if errors.Is(err, profile.ErrChanged) {
+			m.Overwrite, m.EditorStale = name, true
+			m.Warn(name + ".env changed on disk since it was opened; save again to overwrite it")
+			return false
+		}
+		if err != nil {
+			m.Fail("Save failed", err)
+			return false
+		}
+		m.Overwrite, m.EditorStale = "", false
+		m.ReloadProfile(name)
+
+		// Terminals using the profile report schema problems on reload
+		t := m.Terminals[m.ActiveIdx]
+		if t.Profile != name && !slices.Contains(t.Env.Chain, name) {
+			env := profile.Resolve(envDir, name, os.LookupEnv)
+			m.CheckSchema(t, env, t.Dir, buildEnv(env, t.Dir, nil))
 		}
 
 		m.OriginalContent = m.Editor.Value()
+		return true
 	}
+	return false
 }
 
-func (m *Model) BuildEnv() []string {
-	env := os.Environ()
-	for k, v := range m.EnvVars {
-		env = append(env, k+"="+v)
+// injectedEnv keeps output unbuffered and colored in the pane. Profiles
+// can override these keys or drop them with `# @unset`.
+var injectedEnv = map[string]string{
+	"PYTHONUNBUFFERED": "1",
+	"FORCE_COLOR":      "1",
+	"CLICOLOR_FORCE":   "1",
+}
+
+// BuildEnv returns the environment for commands started in t
+func (m *Model) BuildEnv(t *terminal.TerminalPane, overrides map[string]string) []string {
+	return buildEnv(t.Env, t.Dir, overrides)
+}
+
+// buildEnv layers env over the injected variables and the defaults of its
+// schema, if any.
+func buildEnv(env *profile.Env, dir string, overrides map[string]string) []string {
+	return env.ChildEnv(dir, injectedEnv, overrides)
+}
+
+// CheckSchema prints the schema problems of environ in out and reports
+// whether a command may still run; only @strict profiles are blocked.
+func (m *Model) CheckSchema(out *terminal.TerminalPane, env *profile.Env, dir string, environ []string) bool {
+	problems := env.Check(dir, environ)
+	for _, err := range problems {
+		out.AddOutput(styles.Error.Render("schema: " + err.Error()))
 	}
-	return env
+	return len(problems) == 0 || !env.Strict
 }
 
-func (m *Model) UpdateGitBranch() {
+// UpdateGitBranch looks up the branch checked out in the pane's directory
+func UpdateGitBranch(t *terminal.TerminalPane) {
 	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
+	cmd.Dir = t.Dir
 	output, err := cmd.Output()
 	if err == nil {
-		m.GitBranch = strings.TrimSpace(string(output))
+		t.GitBranch = strings.TrimSpace(string(output))
 	} else {
-		m.GitBranch = ""
+		t.GitBranch = ""
 	}
 }
 
-func (m *Model) SaveState() {
+// SaveState remembers the terminals for the next start. Command history
+// is saved as commands run.
+func (m *Model) SaveState() error {
 	envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
-	config.SaveConfig(envDir, m.CurrentProfile)
-	utils.SaveHistory(m.ConfigPath, m.History)
+	return config.Update(envDir, func(cfg *config.AppConfig) {
+		cfg.LastProfile = m.ActiveProfile()
+		cfg.Terminals = cfg.Terminals[:0]
+		for _, t := range m.Terminals {
+			cfg.Terminals = append(cfg.Terminals, config.TerminalState{Dir: t.Dir, Profile: t.Profile})
+		}
+	})
 }
 
-func (m *Model) SaveProfile() {
-	envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
-	var lines []string
+// Fail shows a failed save in the status bar
+func (m *Model) Fail(what string, err error) {
+	m.Warn(what + ": " + err.Error())
+}
 
-	path := filepath.Join(envDir, m.CurrentProfile+".env")
-	if content, err := os.ReadFile(path); err == nil {
-		for _, line := range strings.Split(string(content), "\n") {
-			if strings.HasPrefix(strings.TrimSpace(line), "#") || strings.TrimSpace(line) == "" {
-				lines = append(lines, line)
-			}
+// Warn shows msg in the status bar
+func (m *Model) Warn(msg string) {
+	m.StatusErr = msg
+	m.StatusAt = time.Now()
+}
+
+// ActiveProfile is the profile of the focused terminal
+func (m Model) ActiveProfile() string {
+	return m.Terminals[m.ActiveIdx].Profile
+}
+
+// ProfileInUse reports whether any terminal is bound to the profile
+func (m *Model) ProfileInUse(name string) bool {
+	for _, t := range m.Terminals {
+		if t.Profile == name {
+			return true
 		}
 	}
+	return false
+}
 
-	keys := make([]string, 0, len(m.EnvVars))
-	for k := range m.EnvVars {
-		keys = append(keys, k)
+// ReloadProfile re-resolves every terminal whose environment depends on
+// the named profile, directly or through @extends.
+func (m *Model) ReloadProfile(name string) {
+	for _, t := range m.Terminals {
+		if t.Profile == name || (t.Env != nil && slices.Contains(t.Env.Chain, name)) {
+			m.LoadProfile(t, t.Profile)
+		}
 	}
-	sort.Strings(keys)
-	for _, k := range keys {
-		lines = append(lines, k+"="+m.EnvVars[k])
+}
+
+// LoadProfile binds t to a profile, creating the file if it is missing,
+// and resolves its variables. Nothing is exported to this process.
+func (m *Model) LoadProfile(t *terminal.TerminalPane, name string) {
+	envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+	path := profile.Path(envDir, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := profile.Create(envDir, name); err != nil {
+			m.Fail("Could not create "+name, err)
+		}
 	}
 
-	os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	t.Profile = name
+	t.Env = profile.Resolve(envDir, name, os.LookupEnv)
+	environ := m.BuildEnv(t, nil)
+	t.AddSecrets(t.Env.SecretValues(environ, m.SecretPatterns)...)
+	m.CheckSchema(t, t.Env, t.Dir, environ)
+	for _, err := range t.Env.Errors {
+		t.AddOutput(styles.Error.Render(err.Error()))
+	}
 }
 
-func (m *Model) LoadProfile(path string) {
-	m.EnvVars = make(map[string]string)
-	content, err := os.ReadFile(path)
+// AutoSwitch switches t to the profile bound to its directory, asking
+// first when an .envy file is not trusted yet, and restores the previous
+// profile once t leaves the bound tree.
+func (m *Model) AutoSwitch(t *terminal.TerminalPane) {
+	envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+	cfg := config.LoadConfig(envDir)
+	b, err := binding.Find(cfg, t.Dir)
 	if err != nil {
-		if os.IsNotExist(err) {
-			os.WriteFile(path, []byte("# Environment\n"), 0644)
-		}
+		t.AddOutput(styles.Error.Render(err.Error()))
 		return
 	}
-	for _, line := range strings.Split(string(content), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+	if b == nil || b.Dir != t.DeniedDir {
+		t.DeniedDir = ""
+	}
+
+	switch {
+	case b == nil:
+		if t.BoundDir == "" {
+			return
+		}
+		name := t.PrevProfile
+		t.BoundDir, t.PrevProfile = "", ""
+		if name != t.Profile && profile.Exists(envDir, name) {
+			m.LoadProfile(t, name)
+			t.AddOutput(styles.Muted.Render("↩ Back to " + name))
+		}
+	case b.Dir == t.BoundDir || b.Dir == t.DeniedDir:
+		// Still inside the same tree; a manual `switch` there sticks
+	case !b.Trusted(cfg):
+		if m.Mode != ModeInput {
+			m.Trust, m.TrustTerm = b, t.ID
+			m.Mode = ModeInput
+			m.InputPurpose = "trust"
+			m.InputModel.Placeholder = ""
+			m.InputModel.SetValue("")
+			m.InputModel.Focus()
 		}
-		if parts := strings.SplitN(line, "=", 2); len(parts) == 2 {
-			key := strings.TrimSpace(parts[0])
-			value := strings.Trim(strings.TrimSpace(parts[1]), `"'`)
-			m.EnvVars[key] = value
-			os.Setenv(key, value)
+	default:
+		m.enterBinding(t, b)
+	}
+}
+
+func (m *Model) enterBinding(t *terminal.TerminalPane, b *binding.Binding) {
+	envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+	if !profile.Exists(envDir, b.Profile) {
+		t.AddOutput(styles.Error.Render(b.Dir + " is bound to " + b.Profile + ", which does not exist"))
+		return
+	}
+	if t.BoundDir == "" {
+		t.PrevProfile = t.Profile
+	}
+	t.BoundDir = b.Dir
+	if t.Profile != b.Profile {
+		m.LoadProfile(t, b.Profile)
+		t.AddOutput(styles.Success.Render("✓ Switched " + t.Name + " to " + b.Profile + " for " + b.Dir))
+	}
+}
+
+// SetRevealed shows or masks secrets everywhere. Revealing returns a
+// command that masks them again after RevealFor.
+func (m *Model) SetRevealed(revealed bool) tea.Cmd {
+	m.Revealed = revealed
+	m.RevealSeq++
+	m.SyncMasked()
+	for _, t := range m.Terminals {
+		t.SetRevealed(revealed)
+	}
+	if !revealed {
+		return nil
+	}
+	seq := m.RevealSeq
+	return tea.Tick(m.RevealFor, func(time.Time) tea.Msg { return RevealExpiredMsg{Seq: seq} })
+}
+
+// SyncMasked copies the editor content, with secret values masked, to the
+// read-only view shown instead of the editor until secrets are revealed.
+// The value is masked in the document rather than on screen so it is
+// hidden however the editor wraps or scrolls it.
+func (m *Model) SyncMasked() {
+	masked, ok := profile.MaskDocument(m.Editor.Value(), m.SecretPatterns)
+	m.EditorMasked = ok
+	if ok && masked != m.MaskedView.Value() {
+		line := m.MaskedView.Line()
+		m.MaskedView.SetValue(masked)
+		for m.MaskedView.Line() > line {
+			m.MaskedView.CursorUp()
 		}
 	}
 }
 
+// Masking reports whether the editor is replaced by its masked copy
+func (m Model) Masking() bool {
+	return m.EditorMasked && !m.Revealed
+}
+
 func (m *Model) GetHelp() string {
 	return `
 ` + styles.Title.Render("Commands") + `
-  env           Show variables
-  set K V       Set variable
-  unset K       Remove variable
+  env [--child] Show variables, or everything a command would get
+  export [-f F] Print profile as bash/fish/powershell/docker/systemd/json
+  import SRC    Merge a .env/JSON/YAML/compose file or @env into a profile
+  set K V       Set variable (--secret to encrypt it)
+  unset K       Remove variable (--hide to drop the host's too)
+  secret rotate Re-encrypt all secrets with a new key
+  check [NAME]  Check a profile against its @schema
+  diff A B      Compare profiles, .env files or @host
+  merge A B     Merge profile A into B (--base, --include)
+  copy-keys A B GLOB  Copy matching keys from A to B
+  history       List saved revisions (diff N, restore N)
+  undo          Revert the last write to this profile
   switch NAME   Change profile
+  bind NAME [D] Switch to NAME on cd into D (default: here)
+  unbind [D]    Remove the binding of D
   new NAME      Create profile
   open          Open envs folder
+  pty [on|off]  Run commands in a pseudo-terminal
+  signal S [T]  Send a signal to the command in terminal T
   clear         Clear terminal
   exit          Quit
 
@@ -213,6 +467,71 @@ func (m *Model) GetHelp() string {
   Ctrl+W        Close terminal
   Ctrl+H/L      Switch terminals
   Ctrl+E        Profile editor
-  Ctrl+C        Kill process
-  Ctrl+D        Exit`
+  Ctrl+C        Stop process (INT; press again for TERM, then KILL)
+  Ctrl+G        Signal menu
+  Ctrl+\        Send SIGQUIT
+  Ctrl+R        Reveal secrets for a while
+  Ctrl+D        Exit
+  Ctrl+]        Then a shortcut, while a program runs in a pty`
+}
+
+// ApplyMerge writes a resolved merge plan and reports it in the active
+// terminal.
+func (m *Model) ApplyMerge(plan *merge.Plan) {
+	t := m.Terminals[m.ActiveIdx]
+	envDir := filepath.Join(m.ConfigPath, config.EnvFolderName)
+	if err := merge.Apply(envDir, plan); err != nil {
+		t.AddOutput(styles.Error.Render("merge: " + err.Error()))
+		return
+	}
+	m.ReloadProfile(plan.Into)
+	m.LoadEditorContent()
+
+	var set []string
+	deleted := slices.Clone(plan.Delete)
+	for _, v := range plan.Set {
+		set = append(set, v.Key)
+	}
+	for _, c := range plan.Conflicts {
+		switch {
+		case c.Choice == merge.KeepMine:
+		case c.Choice == merge.TakeTheirs && c.Theirs == nil:
+			deleted = append(deleted, c.Key)
+		default:
+			set = append(set, c.Key)
+		}
+	}
+	if len(set) > 0 {
+		t.AddOutput(styles.Success.Render(fmt.Sprintf("%d set: %s", len(set), strings.Join(set, ", "))))
+	}
+	if len(deleted) > 0 {
+		t.AddOutput(styles.Git.Render(fmt.Sprintf("%d deleted: %s", len(deleted), strings.Join(deleted, ", "))))
+	}
+	t.AddOutput(styles.Success.Render("✓ Merged " + plan.From + " into " + plan.Into))
+}
+
+// FindTerminal looks a terminal up by ID or name
+func (m *Model) FindTerminal(ref string) *terminal.TerminalPane {
+	for _, t := range m.Terminals {
+		if fmt.Sprint(t.ID) == ref || strings.EqualFold(t.Name, ref) {
+			return t
+		}
+	}
+	return nil
+}
+
+// SendSignal delivers a signal to target's running command and reports the
+// outcome in out.
+func (m *Model) SendSignal(out, target *terminal.TerminalPane, name string) {
+	proc := target.Proc()
+	if proc == nil || proc.Cmd == nil || proc.Cmd.Process == nil {
+		out.AddOutput(styles.Error.Render("signal: nothing running in " + target.Name))
+		return
+	}
+	c := proc.Cmd
+	if err := utils.SignalProcess(c, name); err != nil {
+		out.AddOutput(styles.Error.Render(fmt.Sprintf("signal: %v", err)))
+		return
+	}
+	out.AddOutput(styles.Muted.Render(fmt.Sprintf("⚡ SIG%s → %s (pid %d)", name, target.Name, c.Process.Pid)))
 }
@@ -0,0 +1,71 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/MasFana/fana-envy/internal/config"
+	"github.com/MasFana/fana-envy/internal/terminal"
+	"github.com/MasFana/fana-envy/internal/utils"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var sgrPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func TestHelpRendersInPane(t *testing.T) {
+	help := (&Model{}).GetHelp()
+	pane := terminal.NewTerminalPane(1)
+	pane.Resize(120, 60)
+	pane.AddOutput(help)
+
+	var got []string
+	for _, l := range strings.Split(pane.GetOutput(), "\n") {
+		got = append(got, strings.TrimRight(sgrPattern.ReplaceAllString(l, ""), " "))
+	}
+	for _, want := range strings.Split(sgrPattern.ReplaceAllString(help, ""), "\n") {
+		want = strings.TrimRight(want, " ")
+		if want == "" {
+			continue
+		}
+		found := false
+		for _, l := range got {
+			if l == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("help line %q not rendered as is; output:\n%s", want, strings.Join(got, "\n"))
+			return
+		}
+	}
+}
+
+func TestEditorMasksLongSecrets(t *testing.T) {
+	m := InitialModel()
+	defer os.RemoveAll(filepath.Join(utils.GetExecutableDir(), config.EnvFolderName))
+
+	secret := strings.Repeat("Q", 200)
+	m.Width, m.Height = 60, 30
+	m.UpdateViewportSizes()
+	m.Editor.SetValue("PORT=80\nAPI_KEY=" + secret + "\n")
+	m.SyncMasked()
+
+	pane := m.buildProfilePane(30, 20)
+	if strings.Contains(pane, "QQ") {
+		t.Errorf("secret shown in editor:\n%s", pane)
+	}
+
+	model, _ := m.handleEditorKey(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	if got := model.(Model).Editor.Value(); got != m.Editor.Value() {
+		t.Errorf("masked editor was edited: %q", got)
+	}
+
+	m.SetRevealed(true)
+	if pane := m.buildProfilePane(30, 20); !strings.Contains(pane, "QQQ") {
+		t.Errorf("secret not revealed:\n%s", pane)
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"path/filepath"
 
 	"github.com/MasFana/fana-envy/internal/config"
+	"github.com/MasFana/fana-envy/internal/profile"
+	"github.com/MasFana/fana-envy/internal/secrets"
 	"github.com/MasFana/fana-envy/internal/styles"
 	"github.com/MasFana/fana-envy/internal/terminal"
 	"github.com/MasFana/fana-envy/internal/utils"
+	"github.com/charmbracelet/bubbles/cursor"
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
@@ -24,7 +27,7 @@ func InitialModel() Model {
 	cfg := config.LoadConfig(envDir)
 	profileName := cfg.LastProfile
 	if profileName == "" {
-		profileName = "default"
+		profileName = profile.DefaultName
 	}
 
 	ti := textinput.New()
@@ -35,37 +38,77 @@ func InitialModel() Model {
 	ta.ShowLineNumbers = true
 	ta.Prompt = " "
 
+	// Looks blurred and has no cursor since it cannot be edited, but stays
+	// focused to scroll
+	mv := textarea.New()
+	mv.ShowLineNumbers = true
+	mv.Prompt = " "
+	_, mv.FocusedStyle = textarea.DefaultStyles()
+	mv.Cursor.SetMode(cursor.CursorHide)
+	mv.Focus()
+
 	fi := textinput.New()
 	fi.Cursor.Style = styles.Selected
 	fi.Prompt = ""
 	fi.Placeholder = "Profile Name"
 
+	// Reopen the terminals of the last session in their directories and
+	// profiles
+	var terms []*terminal.TerminalPane
+	for _, st := range cfg.Terminals {
+		t := terminal.NewTerminalPane(len(terms) + 1)
+		if info, err := os.Stat(st.Dir); err == nil && info.IsDir() {
+			t.Dir = st.Dir
+		}
+		t.Profile = profileName
+		if st.Profile != "" && profile.Exists(envDir, st.Profile) {
+			t.Profile = st.Profile
+		}
+		terms = append(terms, t)
+	}
+	if len(terms) == 0 {
+		t := terminal.NewTerminalPane(1)
+		t.Profile = profileName
+		terms = append(terms, t)
+	}
+	for _, t := range terms {
+		UpdateGitBranch(t)
+	}
+
 	m := Model{
-		Terminals:      []*terminal.TerminalPane{terminal.NewTerminalPane(1)},
+		Terminals:      terms,
 		ActiveIdx:      0,
-		NextID:         2,
-		CurrentProfile: profileName,
+		NextID:         len(terms) + 1,
 		RootPath:       cwd,    // Keep RootPath as CWD for file operations
 		ConfigPath:     exeDir, // New field for config storage location
-		EnvVars:        make(map[string]string),
 		Mode:           ModeTerminal,
 		History:        utils.LoadHistory(exeDir), // Load history from exe dir
 		HistoryIdx:     -1,
+		KillGrace:      cfg.KillGrace(),
+		SecretPatterns: cfg.SecretPatterns,
+		RevealFor:      cfg.RevealFor(),
+		Secrets:        secrets.NewResolver(cfg.FetchTimeout()),
 		Width:          100,
 		Height:         30,
 		InputModel:     ti,
 		Editor:         ta,
+		MaskedView:     mv,
 		FilenameInput:  fi,
 	}
 
-	// Load profile
-	m.LoadProfile(filepath.Join(envDir, profileName+".env"))
-	m.UpdateGitBranch()
+	if m.SecretPatterns == nil {
+		m.SecretPatterns = profile.DefaultSecretPatterns
+	}
+	for _, t := range m.Terminals {
+		m.LoadProfile(t, t.Profile)
+		m.AutoSwitch(t)
+	}
 	m.LoadProfiles()
+	m.Watched, _ = profile.Stamps(envDir)
 
 	return m
 }
 
 func (m Model) Init() tea.Cmd {
-	return textinput.Blink
+	return tea.Batch(textinput.Blink, watch())
 }
@@ -1,6 +1,12 @@
 package tui
 
 import (
+	"time"
+
+	"github.com/MasFana/fana-envy/internal/binding"
+	"github.com/MasFana/fana-envy/internal/merge"
+	"github.com/MasFana/fana-envy/internal/profile"
+	"github.com/MasFana/fana-envy/internal/secrets"
 	"github.com/MasFana/fana-envy/internal/terminal"
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -13,6 +19,7 @@ const (
 	ModeProfiles
 	ModeInput
 	ModeEditor
+	ModeConflict // Resolving merge conflicts in the profile pane
 )
 
 // Model is the main application state
@@ -23,14 +30,19 @@ type Model struct {
 	NextID    int
 
 	// Profile state
-	CurrentProfile  string
 	RootPath        string
 	ConfigPath      string // Path where config/envs are stored
-	EnvVars         map[string]string
 	Profiles        []string
 	SelectedIdx     int
 	Editor          textarea.Model // Full text editor
+	MaskedView      textarea.Model // Read-only copy of Editor shown while secrets are masked
+	EditorMasked    bool           // The editor content has secret values to mask
 	OriginalContent string         // Logic to track changes
+	EditorStale     bool           // The file changed on disk while the editor had unsaved edits
+	Overwrite       string         // Profile the next save may overwrite although it changed on disk
+
+	// Profiles on disk at the last check, to notice edits made elsewhere
+	Watched map[string]profile.Stamp
 
 	// Editor Header
 	FilenameInput textinput.Model
@@ -42,15 +54,43 @@ type Model struct {
 	// History
 	History    []string
 	HistoryIdx int
-	GitBranch  string
+
+	// Processes
+	KillGrace  time.Duration // Wait between SIGINT, SIGTERM and SIGKILL
+	EscapeNext bool          // Ctrl+] was pressed: the next key is a shortcut, not input for the program
+
+	// Secrets
+	SecretPatterns []string      // Key globs masked on screen
+	RevealFor      time.Duration // How long Ctrl+R shows secrets
+	Revealed       bool
+	RevealSeq      int               // Bumped on every toggle so stale timeouts are ignored
+	Secrets        *secrets.Resolver // Fetches `@cmd:`, `@file:` and `@env:` values, cached for the session
 
 	// UI
 	Width  int
 	Height int
 
+	// Errors
+	StatusErr string    // Last failed save or warning, shown in the status bar for a while
+	StatusAt  time.Time // When StatusErr happened
+	ExitErr   error     // Saving state on exit failed, printed once the TUI is gone
+
 	// Input Overlay
 	InputModel   textinput.Model
-	InputPurpose string // "new", "delete"
+	InputPurpose string // "new", "delete", "signal"
+
+	// Signal menu
+	SignalIdx    int
+	SignalTarget int // Terminal ID the menu sends to
+
+	// Directory bindings
+	Trust     *binding.Binding // .envy waiting for the trust prompt
+	TrustTerm int              // Terminal ID that entered its directory
+
+	// Merge conflicts
+	Merge        *merge.Plan
+	MergeIdx     int
+	MergeSecrets map[string]bool // Keys marked `# @secret` on either side
 
 	// Autocomplete State
 	Completions    []string
@@ -67,6 +107,14 @@ type OutputMsg struct {
 	Line   string
 }
 
+// WatchMsg checks envs/ for edits made outside this instance
+type WatchMsg struct{}
+
+// RevealExpiredMsg masks secrets again after a reveal timed out
+type RevealExpiredMsg struct {
+	Seq int
+}
+
 type CmdDoneMsg struct {
 	TermID int
 	Err    error
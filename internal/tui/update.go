@@ -2,6 +2,7 @@ package tui
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/MasFana/fana-envy/internal/styles"
 	"github.com/MasFana/fana-envy/internal/terminal"
@@ -54,6 +55,20 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, nil
 
+	case WatchMsg:
+		m.CheckEnvDir()
+		return m, watch()
+
+	case RevealExpiredMsg:
+		if m.Revealed && msg.Seq == m.RevealSeq {
+			if m.Mode == ModeEditor && m.Editor.Value() != m.OriginalContent {
+				// Masking would make the editor read-only mid-edit
+				return m, m.SetRevealed(true)
+			}
+			m.SetRevealed(false)
+		}
+		return m, nil
+
 	case tea.KeyMsg:
 		return m.handleKey(msg)
 	}
@@ -77,12 +92,49 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// escapeKey makes the next key a shortcut while a program runs on a
+// pseudo-terminal, since the program gets the shortcuts' keys itself
+const escapeKey = "ctrl+]"
+
+// ptyKeys are the shortcuts that programs on a pseudo-terminal commonly use
+// themselves: reverse search, word motion, redraw and so on
+var ptyKeys = map[string]bool{
+	"ctrl+n": true, "ctrl+w": true, "ctrl+h": true, "ctrl+l": true,
+	"ctrl+left": true, "ctrl+right": true, "ctrl+e": true, "ctrl+g": true,
+	"ctrl+r": true,
+}
+
 func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	escaped := m.EscapeNext
+	m.EscapeNext = false
+	if proc := m.Terminals[m.ActiveIdx].Proc(); m.Mode == ModeTerminal && proc != nil && proc.PTY != nil {
+		switch {
+		case escaped && msg.String() == escapeKey:
+			// Pressed twice: the program gets it
+			return m.handleTerminalKey(msg)
+		case escaped:
+		case msg.String() == escapeKey:
+			m.EscapeNext = true
+			return m, nil
+		case ptyKeys[msg.String()]:
+			return m.handleTerminalKey(msg)
+		}
+	}
+
 	// Global shortcuts
 	switch msg.String() {
 	case "ctrl+n":
 		// New terminal
 		t := terminal.NewTerminalPane(m.NextID)
+		active := m.Terminals[m.ActiveIdx]
+		t.UsePTY = active.UsePTY
+		t.Dir = active.Dir
+		t.GitBranch = active.GitBranch
+		t.Profile = active.Profile
+		t.Env = active.Env
+		t.BoundDir, t.PrevProfile, t.DeniedDir = active.BoundDir, active.PrevProfile, active.DeniedDir
+		t.AddSecrets(active.Secrets()...)
+		t.SetRevealed(m.Revealed)
 		m.NextID++
 		t.AddOutput(styles.Muted.Render(fmt.Sprintf("── Terminal %d ──", t.ID)))
 		m.Terminals = append(m.Terminals, t)
@@ -95,9 +147,8 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		// Close terminal
 		if len(m.Terminals) > 1 {
 			// Kill any running process
-			t := m.Terminals[m.ActiveIdx]
-			if t.Running && t.Cmd != nil {
-				utils.KillProcess(t.Cmd)
+			if proc := m.Terminals[m.ActiveIdx].Proc(); proc != nil && proc.Cmd != nil {
+				utils.KillProcess(proc.Cmd, m.KillGrace)
 			}
 			m.Terminals = append(m.Terminals[:m.ActiveIdx], m.Terminals[m.ActiveIdx+1:]...)
 			if m.ActiveIdx >= len(m.Terminals) {
@@ -135,21 +186,69 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "ctrl+d":
 		// Exit
 		if m.Mode == ModeTerminal {
-			t := m.Terminals[m.ActiveIdx]
-			if !t.Running {
-				m.SaveState()
+			proc := m.Terminals[m.ActiveIdx].Proc()
+			if proc != nil && proc.PTY != nil {
+				proc.PTY.Write([]byte{4})
+			} else if proc == nil {
+				m.ExitErr = m.SaveState()
 				m.Quitting = true
 				return m, tea.Quit
 			}
 		}
 		return m, nil
 
+	case "ctrl+g":
+		// Signal menu for the running command
+		if m.Mode == ModeTerminal {
+			t := m.Terminals[m.ActiveIdx]
+			if !t.IsRunning() {
+				t.AddOutput(styles.Muted.Render("Nothing running"))
+				return m, nil
+			}
+			m.Mode = ModeInput
+			m.InputPurpose = "signal"
+			m.SignalTarget = t.ID
+			m.SignalIdx = 0
+			m.InputModel.Placeholder = "or type a name..."
+			m.InputModel.SetValue("")
+			m.InputModel.Focus()
+		}
+		return m, nil
+
+	case "ctrl+\\":
+		if m.Mode == ModeTerminal {
+			t := m.Terminals[m.ActiveIdx]
+			if proc := t.Proc(); proc != nil && proc.PTY != nil {
+				proc.PTY.Write([]byte{0x1c})
+			} else if proc != nil {
+				m.SendSignal(t, t, "QUIT")
+			}
+		}
+		return m, nil
+
+	case "ctrl+r":
+		// Reveal secrets until the timeout, or mask them again
+		return m, m.SetRevealed(!m.Revealed)
+
 	case "ctrl+c":
 		// Kill running process
 		if m.Mode == ModeTerminal {
 			t := m.Terminals[m.ActiveIdx]
-			if t.Running && t.Cmd != nil {
-				utils.KillProcess(t.Cmd)
+			proc := t.Proc()
+			if proc != nil && proc.PTY != nil {
+				if time.Since(t.Interrupted) < m.KillGrace {
+					// Pressed again before the command stopped: it may
+					// ignore SIGINT, so escalate like KillProcess does
+					utils.Terminate(proc.Cmd, m.KillGrace)
+					t.AddOutput(styles.Muted.Render("^C again: sending TERM, then KILL"))
+					t.Interrupted = time.Time{}
+					return m, nil
+				}
+				// The terminal driver turns ^C into SIGINT for the foreground job
+				proc.PTY.Write([]byte{3})
+				t.Interrupted = time.Now()
+			} else if proc != nil && proc.Cmd != nil {
+				utils.KillProcess(proc.Cmd, m.KillGrace)
 				t.AddOutput("^C")
 			} else {
 				t.Input.SetValue("")
@@ -168,6 +267,8 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m.handleInputKey(msg)
 	case ModeEditor:
 		return m.handleEditorKey(msg)
+	case ModeConflict:
+		return m.handleConflictKey(msg)
 	}
 	return m, nil
 }
@@ -0,0 +1,55 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MasFana/fana-envy/internal/config"
+	"github.com/MasFana/fana-envy/internal/utils"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestShortcutsGoToPTYProgram(t *testing.T) {
+	m := InitialModel()
+	defer os.RemoveAll(filepath.Join(utils.GetExecutableDir(), config.EnvFolderName))
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	pane := m.Terminals[m.ActiveIdx]
+	pane.PTY, pane.Running = w, true
+
+	press := func(model tea.Model, key tea.KeyType) Model {
+		next, _ := model.(Model).handleKey(tea.KeyMsg{Type: key})
+		return next.(Model)
+	}
+	read := func() string {
+		buf := make([]byte, 16)
+		n, _ := r.Read(buf)
+		return string(buf[:n])
+	}
+
+	m = press(m, tea.KeyCtrlE)
+	if m.Mode != ModeTerminal {
+		t.Errorf("Ctrl+E opened the editor while a program runs")
+	}
+	if got := read(); got != "\x05" {
+		t.Errorf("program got %q, want Ctrl+E", got)
+	}
+
+	m = press(m, tea.KeyCtrlCloseBracket)
+	m = press(m, tea.KeyCtrlCloseBracket)
+	if got := read(); got != "\x1d" {
+		t.Errorf("program got %q after Ctrl+] twice, want Ctrl+]", got)
+	}
+
+	m = press(m, tea.KeyCtrlCloseBracket)
+	m = press(m, tea.KeyCtrlE)
+	if m.Mode != ModeProfiles {
+		t.Errorf("Ctrl+] Ctrl+E did not open the editor")
+	}
+}
@@ -2,13 +2,18 @@ package tui
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/MasFana/fana-envy/internal/config"
+	"github.com/MasFana/fana-envy/internal/dotenv"
+	"github.com/MasFana/fana-envy/internal/merge"
+	"github.com/MasFana/fana-envy/internal/profile"
 	"github.com/MasFana/fana-envy/internal/styles"
+	"github.com/MasFana/fana-envy/internal/utils"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
 )
 
 func (m Model) View() string {
@@ -33,6 +38,8 @@ func (m Model) View() string {
 	var pane string
 	if m.Mode == ModeProfiles || m.Mode == ModeEditor {
 		pane = m.buildProfilePane(paneWidth, contentHeight)
+	} else if m.Merge != nil && (m.Mode == ModeConflict || m.InputPurpose == "merge_edit") {
+		pane = m.buildConflictPane(paneWidth, contentHeight)
 	} else {
 		pane = m.buildTerminalPane(paneWidth, contentHeight)
 	}
@@ -66,6 +73,15 @@ func (m Model) overlayInput(underlying string) string {
 		prompt = "Save changes before exiting? (y/n)"
 	case "error":
 		title = " Error "
+	case "signal":
+		title = " Send Signal "
+		prompt = m.signalMenu()
+	case "trust":
+		title = " Trust Directory "
+		prompt = fmt.Sprintf("%s wants to switch to profile %s. Allow? (y/n)", m.Trust.Marker, m.Trust.Profile)
+	case "merge_edit":
+		title = " Edit Value "
+		prompt = m.Merge.Conflicts[m.MergeIdx].Key + "="
 	}
 
 	box := lipgloss.NewStyle().
@@ -83,6 +99,33 @@ func (m Model) overlayInput(underlying string) string {
 	return PlaceOverlay(m.Width, m.Height, box, underlying)
 }
 
+// signalDescriptions explains the signals offered in the signal menu
+var signalDescriptions = map[string]string{
+	"INT":  "interrupt",
+	"TERM": "terminate",
+	"HUP":  "hang up / reload",
+	"QUIT": "quit with dump",
+	"USR1": "user defined 1",
+	"USR2": "user defined 2",
+	"TSTP": "pause",
+	"CONT": "resume",
+	"STOP": "stop (cannot be caught)",
+	"KILL": "kill",
+}
+
+func (m Model) signalMenu() string {
+	var b strings.Builder
+	for i, name := range utils.SignalNames {
+		line := fmt.Sprintf("%-5s %s", name, signalDescriptions[name])
+		if i == m.SignalIdx {
+			b.WriteString(styles.Selected.Render("▸ "+line) + "\n")
+		} else {
+			b.WriteString(styles.Muted.Render("  "+line) + "\n")
+		}
+	}
+	return lipgloss.NewStyle().Align(lipgloss.Left).Render(b.String())
+}
+
 func PlaceOverlay(width, height int, overlay, background string) string {
 	return lipgloss.Place(width, height, lipgloss.Center, lipgloss.Center, overlay,
 		lipgloss.WithWhitespaceChars(" "), lipgloss.WithWhitespaceForeground(lipgloss.Color("")))
@@ -109,7 +152,7 @@ func (m Model) buildSidebar(height int) string {
 		}
 
 		status := ""
-		if t.Running {
+		if t.IsRunning() {
 			status = styles.Running.Render(" ●")
 		}
 
@@ -118,6 +161,12 @@ func (m Model) buildSidebar(height int) string {
 			name = name[:styles.SidebarWidth-8]
 		}
 		b.WriteString(marker + style.Render(name) + status + "\n")
+
+		prof := t.Profile
+		if len(prof) > styles.SidebarWidth-10 {
+			prof = prof[:styles.SidebarWidth-10] + "…"
+		}
+		b.WriteString("    " + styles.Profile.Render(prof) + "\n")
 	}
 
 	profTitle := "  Environment"
@@ -130,7 +179,7 @@ func (m Model) buildSidebar(height int) string {
 	b.WriteString(strings.Repeat("─", styles.SidebarWidth-4) + "\n")
 
 	for i, p := range m.Profiles {
-		isActive := (p == m.CurrentProfile)
+		isActive := (p == m.ActiveProfile())
 		isSelected := (i == m.SelectedIdx)
 
 		var line strings.Builder
@@ -148,6 +197,8 @@ func (m Model) buildSidebar(height int) string {
 		activeMark := "  "
 		if isActive {
 			activeMark = styles.Success.Render("● ")
+		} else if m.ProfileInUse(p) {
+			activeMark = styles.Muted.Render("○ ")
 		}
 		line.WriteString(activeMark)
 
@@ -192,7 +243,7 @@ func (m Model) buildTerminalPane(width, height int) string {
 	var b strings.Builder
 
 	title := styles.Title.Render(" " + t.Name + " ")
-	if t.Running {
+	if t.IsRunning() {
 		title += styles.Running.Render(" ● ")
 	}
 	b.WriteString(title + "\n")
@@ -231,21 +282,118 @@ func (m Model) buildProfilePane(width, height int) string {
 		nameStr = styles.Profile.Render(profileName + ".env")
 	}
 
+	if m.EditorStale {
+		nameStr += styles.Error.Render(" (changed on disk)")
+	}
 	b.WriteString(styles.Title.Render(headerStr) + nameStr + "\n")
 	b.WriteString(strings.Repeat("─", width-4) + "\n")
 
-	b.WriteString(m.Editor.View())
+	if m.Masking() {
+		b.WriteString(m.MaskedView.View())
+	} else {
+		b.WriteString(m.Editor.View())
+	}
 
 	hint := "n: new │ d: delete │ r: rename │ Tab: edit"
-	if m.Mode == ModeEditor {
-		hint = "Ctrl+S: save │ Esc/Tab: back"
+	switch {
+	case m.Mode == ModeEditor && m.Masking():
+		hint = "Ctrl+R: reveal to edit │ Esc/Tab: back"
+	case m.Mode == ModeEditor:
+		hint = "Ctrl+S: save │ Ctrl+R: reveal │ Esc/Tab: back"
 	}
 
 	return style.Render(b.String() + "\n" + styles.Muted.Render(hint))
 }
 
+// buildConflictPane lists the conflicts of a merge with both values and
+// the decision made so far.
+func (m Model) buildConflictPane(width, height int) string {
+	plan := m.Merge
+	var b strings.Builder
+
+	title := fmt.Sprintf("Merge: %s → %s", plan.From, plan.Into)
+	if plan.Base != "" {
+		title += " (base " + plan.Base + ")"
+	}
+	b.WriteString(styles.Title.Render(title) + "\n")
+	b.WriteString(strings.Repeat("─", width-4) + "\n")
+
+	secret := func(key string) bool {
+		return !m.Revealed && (m.MergeSecrets[key] || profile.MatchesSecret(key, m.SecretPatterns))
+	}
+	value := func(key string, v *dotenv.Var) string {
+		switch {
+		case v == nil:
+			return styles.Muted.Render("(deleted)")
+		case secret(key):
+			return profile.Masked
+		}
+		return v.Value
+	}
+	choices := map[merge.Resolution]string{
+		merge.Unresolved: styles.Error.Render("?"),
+		merge.KeepMine:   styles.Success.Render("mine"),
+		merge.TakeTheirs: styles.Success.Render("theirs"),
+		merge.Edited:     styles.Success.Render("edited"),
+	}
+	// One block per conflict; scroll so the selected one stays visible
+	blocks := make([]string, len(plan.Conflicts))
+	for i, c := range plan.Conflicts {
+		marker, style := "  ", styles.Normal
+		if i == m.MergeIdx {
+			marker, style = "➤ ", styles.Selected
+		}
+		block := marker + style.Render(c.Key) + "  " + choices[c.Choice] + "\n"
+		block += "    mine:   " + value(c.Key, c.Mine) + "\n"
+		block += "    theirs: " + value(c.Key, c.Theirs) + "\n"
+		if plan.Base != "" {
+			block += styles.Muted.Render("    base:   ") + value(c.Key, c.Base) + "\n"
+		}
+		if c.Choice == merge.Edited {
+			edited := c.Value
+			if secret(c.Key) {
+				edited = profile.Masked
+			}
+			block += "    edited: " + edited + "\n"
+		}
+		blocks[i] = block
+	}
+	start, room := 0, height-6
+	for used := 0; start < m.MergeIdx; start++ {
+		used = 0
+		for _, block := range blocks[start : m.MergeIdx+1] {
+			used += strings.Count(block, "\n")
+		}
+		if used <= room {
+			break
+		}
+	}
+	for used, i := 0, start; i < len(blocks); i++ {
+		if used += strings.Count(blocks[i], "\n"); used > room && i > m.MergeIdx {
+			break
+		}
+		b.WriteString(blocks[i])
+	}
+
+	hint := fmt.Sprintf("%d unresolved │ m: mine │ t: theirs │ e: edit │ M/T: all │ Enter: apply │ Esc: cancel", plan.Unresolved())
+	return styles.Pane.Width(width).Height(height).Render(b.String() + "\n" + styles.Muted.Render(hint))
+}
+
+// statusErrFor is how long a failed save stays in the status bar
+const statusErrFor = 10 * time.Second
+
 func (m Model) buildStatusBar() string {
-	left := fmt.Sprintf(" %s v%s │ [%s]", config.AppName, config.Version, m.CurrentProfile)
+	left := fmt.Sprintf(" %s v%s │ [%s]", config.AppName, config.Version, m.ActiveProfile())
+	if m.Revealed {
+		left += " │ secrets visible"
+	}
+	if m.EscapeNext {
+		left += " │ Ctrl+]: next key is a shortcut"
+	}
+	if m.StatusErr != "" && time.Since(m.StatusAt) < statusErrFor {
+		msg := runewidth.Truncate(" "+m.StatusErr+" ", max(m.Width-lipgloss.Width(left), 0), "…")
+		return styles.StatusBar.Width(m.Width-lipgloss.Width(msg)).Render(left) + styles.StatusError.Render(msg)
+	}
 	shortcuts := "'help' | Ctrl+N:new │ Ctrl+H/L:switch | Ctrl+W:close │ Ctrl+E:env │ Ctrl+D:exit"
 
 	gap := m.Width - len(left) - len(shortcuts)
@@ -257,32 +405,32 @@ func (m Model) buildStatusBar() string {
 }
 
 func (m Model) buildPrompt() string {
-	profile := styles.Profile.Render("[" + m.CurrentProfile + "]")
+	t := m.Terminals[m.ActiveIdx]
+	profile := styles.Profile.Render("[" + t.Profile + "]")
 
-	cwd, _ := os.Getwd()
-	dir := filepath.Base(cwd)
-	if cwd == m.RootPath {
+	dir := filepath.Base(t.Dir)
+	if t.Dir == m.RootPath {
 		dir = "~"
 	}
 	path := styles.Path.Render(dir)
 
 	git := ""
-	if m.GitBranch != "" {
-		git = " " + styles.Git.Render("("+m.GitBranch+")")
+	if t.GitBranch != "" {
+		git = " " + styles.Git.Render("("+t.GitBranch+")")
 	}
 
 	return profile + " " + path + git + styles.Prompt.Render(" ➤ ")
 }
 
 func (m Model) buildPromptText() string {
-	cwd, _ := os.Getwd()
-	dir := filepath.Base(cwd)
-	if cwd == m.RootPath {
+	t := m.Terminals[m.ActiveIdx]
+	dir := filepath.Base(t.Dir)
+	if t.Dir == m.RootPath {
 		dir = "~"
 	}
 	git := ""
-	if m.GitBranch != "" {
-		git = " (" + m.GitBranch + ")"
+	if t.GitBranch != "" {
+		git = " (" + t.GitBranch + ")"
 	}
-	return "[" + m.CurrentProfile + "] " + dir + git + " ➤ "
+	return "[" + t.Profile + "] " + dir + git + " ➤ "
 }
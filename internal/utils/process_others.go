@@ -0,0 +1,110 @@
+//go:build !windows
+
+package utils
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// SetProcessGroup makes cmd start in its own process group so KillProcess
+// also reaches everything it spawns.
+func SetProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// A new session (as used for pseudo-terminals) already is its own group
+	if !cmd.SysProcAttr.Setsid {
+		cmd.SysProcAttr.Setpgid = true
+	}
+}
+
+// SignalNames lists the signals that can be sent to a running command
+var SignalNames = []string{"INT", "TERM", "HUP", "QUIT", "USR1", "USR2", "TSTP", "CONT", "STOP", "KILL"}
+
+var signals = map[string]syscall.Signal{
+	"INT":  syscall.SIGINT,
+	"TERM": syscall.SIGTERM,
+	"HUP":  syscall.SIGHUP,
+	"QUIT": syscall.SIGQUIT,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"TSTP": syscall.SIGTSTP,
+	"CONT": syscall.SIGCONT,
+	"STOP": syscall.SIGSTOP,
+	"KILL": syscall.SIGKILL,
+}
+
+func signalNumber(name string) int {
+	return int(signals[name])
+}
+
+// groupTarget returns the kill(2) target for pid: its whole process group
+// when it leads one, otherwise just the process.
+func groupTarget(pid int) int {
+	if pgid, err := syscall.Getpgid(pid); err == nil && pgid == pid {
+		return -pid
+	}
+	return pid
+}
+
+// SignalProcess delivers a signal from SignalNames to cmd's process group
+func SignalProcess(cmd *exec.Cmd, name string) error {
+	sig, ok := signals[name]
+	if !ok {
+		return errors.New("unsupported signal " + name)
+	}
+	if cmd == nil || cmd.Process == nil {
+		return errors.New("no running process")
+	}
+	return syscall.Kill(groupTarget(cmd.Process.Pid), sig)
+}
+
+// KillProcess interrupts cmd's process group, then escalates to SIGTERM
+// and SIGKILL while the group survives longer than grace. It returns right
+// away; the escalation runs in the background.
+func KillProcess(cmd *exec.Cmd, grace time.Duration) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	escalate(groupTarget(cmd.Process.Pid), grace, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
+}
+
+// Terminate is KillProcess for a command that already ignored SIGINT: it
+// starts with SIGTERM.
+func Terminate(cmd *exec.Cmd, grace time.Duration) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	escalate(groupTarget(cmd.Process.Pid), grace, syscall.SIGTERM, syscall.SIGKILL)
+}
+
+// escalate sends the first signal right away and each next one when
+// target is still alive after grace
+func escalate(target int, grace time.Duration, sigs ...syscall.Signal) {
+	if err := syscall.Kill(target, sigs[0]); err != nil {
+		return
+	}
+	go func() {
+		for _, sig := range sigs[1:] {
+			if waitExit(target, grace) {
+				return
+			}
+			syscall.Kill(target, sig)
+		}
+	}()
+}
+
+// waitExit polls until no process is left in target or grace runs out
+func waitExit(target int, grace time.Duration) bool {
+	deadline := time.Now().Add(grace)
+	for time.Now().Before(deadline) {
+		if syscall.Kill(target, 0) == syscall.ESRCH {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
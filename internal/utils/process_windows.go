@@ -0,0 +1,77 @@
+//go:build windows
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// SetProcessGroup is a no-op on Windows; taskkill /T follows the process
+// tree instead.
+func SetProcessGroup(cmd *exec.Cmd) {}
+
+// SignalNames lists the signals that can be sent to a running command.
+// Windows has no signals; TERM asks the process tree to close and KILL
+// force kills it.
+var SignalNames = []string{"TERM", "KILL"}
+
+func signalNumber(name string) int {
+	switch name {
+	case "TERM":
+		return 15
+	case "KILL":
+		return 9
+	}
+	return -1
+}
+
+// SignalProcess emulates a signal from SignalNames with taskkill
+func SignalProcess(cmd *exec.Cmd, name string) error {
+	if cmd == nil || cmd.Process == nil {
+		return errors.New("no running process")
+	}
+	pid := fmt.Sprintf("%d", cmd.Process.Pid)
+	switch name {
+	case "TERM":
+		return exec.Command("taskkill", "/T", "/PID", pid).Run()
+	case "KILL":
+		return exec.Command("taskkill", "/F", "/T", "/PID", pid).Run()
+	}
+	return errors.New("unsupported signal " + name + " on Windows")
+}
+
+// KillProcess asks cmd's process tree to close and force kills it when it
+// is still running after grace. It returns right away; the escalation runs
+// in the background.
+func KillProcess(cmd *exec.Cmd, grace time.Duration) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	pid := fmt.Sprintf("%d", cmd.Process.Pid)
+	h, err := windows.OpenProcess(windows.SYNCHRONIZE, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		exec.Command("taskkill", "/F", "/T", "/PID", pid).Run()
+		return
+	}
+
+	// Console programs ignore the polite request, so don't wait long on it
+	exec.Command("taskkill", "/T", "/PID", pid).Run()
+	go func() {
+		defer windows.CloseHandle(h)
+		if ev, _ := windows.WaitForSingleObject(h, uint32(grace.Milliseconds())); ev == windows.WAIT_OBJECT_0 {
+			return
+		}
+		exec.Command("taskkill", "/F", "/T", "/PID", pid).Run()
+	}()
+}
+
+// Terminate is the same as KillProcess on Windows, which has no SIGINT to
+// skip
+func Terminate(cmd *exec.Cmd, grace time.Duration) {
+	KillProcess(cmd, grace)
+}
@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseSignal turns "hup", "SIGHUP" or "1" into the name used by
+// SignalNames and SignalProcess.
+func ParseSignal(s string) (string, error) {
+	name := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "SIG")
+	n, numErr := strconv.Atoi(name)
+	for _, known := range SignalNames {
+		if known == name || (numErr == nil && signalNumber(known) == n) {
+			return known, nil
+		}
+	}
+	return "", fmt.Errorf("unknown signal %q (use %s)", s, strings.Join(SignalNames, ", "))
+}
@@ -1,14 +1,14 @@
 package utils
 
 import (
-	"fmt"
+	"flag"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"unicode"
 
 	"github.com/MasFana/fana-envy/internal/config"
+	"github.com/MasFana/fana-envy/internal/storage"
 )
 
 func LoadHistory(root string) []string {
@@ -25,11 +25,20 @@ func LoadHistory(root string) []string {
 	return history
 }
 
-func SaveHistory(root string, history []string) {
-	if len(history) > 1000 {
-		history = history[len(history)-1000:]
-	}
-	os.WriteFile(filepath.Join(root, config.HistoryFile), []byte(strings.Join(history, "\n")), 0644)
+// AppendHistory adds a command line to the history file. The file is
+// re-read under the lock so the commands of other instances are kept.
+func AppendHistory(root, line string) error {
+	return storage.Locked(filepath.Join(root, config.EnvFolderName), func() error {
+		history := LoadHistory(root)
+		if len(history) > 0 && history[len(history)-1] == line {
+			return nil
+		}
+		history = append(history, line)
+		if len(history) > 1000 {
+			history = history[len(history)-1000:]
+		}
+		return storage.WriteFile(filepath.Join(root, config.HistoryFile), []byte(strings.Join(history, "\n")), 0644)
+	})
 }
 
 func SmartSplit(input string) []string {
@@ -59,6 +68,53 @@ func SmartSplit(input string) []string {
 	return parts
 }
 
+// ParseFlags parses flags that may appear anywhere among the positional
+// arguments. Everything after "--" is positional.
+func ParseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	return ParseFlagsUntil(fs, args, -1)
+}
+
+// ParseFlagsUntil is ParseFlags that stops looking for flags once it has n
+// positional arguments, so a value like "-1" after them is taken as is.
+// A negative n never stops.
+func ParseFlagsUntil(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	var positional []string
+	for {
+		if n >= 0 && len(positional) >= n {
+			if len(args) > 0 && args[0] == "--" {
+				args = args[1:]
+			}
+			return append(positional, args...), nil
+		}
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// SplitAssignments separates leading KEY=VALUE words, as in
+// `DEBUG=1 go test`, from the command that follows them.
+func SplitAssignments(words []string) (map[string]string, []string) {
+	vars := make(map[string]string)
+	for i, w := range words {
+		k, v, ok := strings.Cut(w, "=")
+		if !ok || !IsValidEnvVar(k) {
+			return vars, words[i:]
+		}
+		vars[k] = v
+	}
+	return vars, nil
+}
+
 func IsValidEnvVar(name string) bool {
 	if len(name) == 0 {
 		return false
@@ -86,13 +142,6 @@ func IsValidProfileName(name string) bool {
 	return true
 }
 
-func KillProcess(cmd *exec.Cmd) {
-	if cmd == nil || cmd.Process == nil {
-		return
-	}
-	exec.Command("taskkill", "/F", "/T", "/PID", fmt.Sprintf("%d", cmd.Process.Pid)).Run()
-}
-
 func GetExecutableDir() string {
 	ex, err := os.Executable()
 	if err != nil {
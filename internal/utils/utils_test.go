@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"flag"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestParseFlagsUntil(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		until  int
+		want   []string
+		secret bool
+	}{
+		{"flags anywhere", []string{"prod", "--secret", "KEY"}, -1, []string{"prod", "KEY"}, true},
+		{"double dash", []string{"prod", "--", "--secret"}, -1, []string{"prod", "--secret"}, false},
+		{"negative value", []string{"prod", "OFFSET", "-1"}, 2, []string{"prod", "OFFSET", "-1"}, false},
+		{"value like a flag", []string{"--secret", "prod", "JAVA_OPTS", "-Xmx512m", "-Xms1g"}, 2, []string{"prod", "JAVA_OPTS", "-Xmx512m", "-Xms1g"}, true},
+		{"flag after the value", []string{"prod", "KEY", "v", "--secret"}, 2, []string{"prod", "KEY", "v", "--secret"}, false},
+		{"double dash before the value", []string{"prod", "KEY", "--", "--x"}, 2, []string{"prod", "KEY", "--x"}, false},
+		{"too few", []string{"prod"}, 2, []string{"prod"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("set", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			secret := fs.Bool("secret", false, "")
+			got, err := ParseFlagsUntil(fs, tt.args, tt.until)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) || *secret != tt.secret {
+				t.Errorf("ParseFlagsUntil(%q, %d) = %q, secret %v; want %q, secret %v", tt.args, tt.until, got, *secret, tt.want, tt.secret)
+			}
+		})
+	}
+
+	fs := flag.NewFlagSet("set", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, err := ParseFlags(fs, []string{"prod", "-1"}); err == nil {
+		t.Error("ParseFlags accepted an unknown flag")
+	}
+}
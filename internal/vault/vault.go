@@ -0,0 +1,254 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/MasFana/fana-envy/internal/storage"
+)
+
+// Encrypted values look like enc:v1:<key id>:<base64 nonce+ciphertext>.
+// The key id is a short fingerprint of the key so a value encrypted with
+// another key is reported as such instead of as corrupt data.
+const Prefix = "enc:v1:"
+
+// EncryptPrefix marks a plaintext value the editor encrypts on save
+const EncryptPrefix = "encrypt:"
+
+const (
+	KeyFile  = ".fana_key"
+	SaltFile = ".fana_salt"
+
+	// PassphraseEnv selects passphrase mode instead of the key file
+	PassphraseEnv = "ENVY_PASSPHRASE"
+	// NewPassphraseEnv holds the passphrase to rotate to
+	NewPassphraseEnv = "ENVY_NEW_PASSPHRASE"
+
+	keySize    = 32
+	iterations = 210_000
+)
+
+var (
+	ErrNoKey    = errors.New("no encryption key: set " + PassphraseEnv + " or store a secret first to create " + KeyFile)
+	ErrWrongKey = errors.New("value was encrypted with a different key")
+	ErrCorrupt  = errors.New("malformed encrypted value")
+)
+
+type Vault struct {
+	key  []byte
+	id   string
+	salt []byte // Set in passphrase mode, where only the salt is stored
+}
+
+// IsEncrypted reports whether value is an encrypted secret
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+func newVault(key []byte) *Vault {
+	sum := sha256.Sum256(key)
+	return &Vault{key: key, id: hex.EncodeToString(sum[:4])}
+}
+
+// Derived keys are cached since PBKDF2 is deliberately slow
+var derived sync.Map // passphrase + salt -> []byte
+
+func fromPassphrase(passphrase string, salt []byte) (*Vault, error) {
+	cacheKey := passphrase + "\x00" + string(salt)
+	if key, ok := derived.Load(cacheKey); ok {
+		v := newVault(key.([]byte))
+		v.salt = salt
+		return v, nil
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, keySize)
+	if err != nil {
+		return nil, err
+	}
+	derived.Store(cacheKey, key)
+	v := newVault(key)
+	v.salt = salt
+	return v, nil
+}
+
+func readEncoded(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+}
+
+func writeEncoded(path string, b []byte) error {
+	return storage.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(b)+"\n"), 0600)
+}
+
+// createEncoded writes n random bytes to path unless another instance
+// created it in the meantime, in which case that content is returned.
+func createEncoded(envDir, path string, n int) (b []byte, err error) {
+	err = storage.Locked(envDir, func() error {
+		if b, err = readEncoded(path); !os.IsNotExist(err) {
+			return err
+		}
+		if b, err = randomBytes(n); err != nil {
+			return err
+		}
+		return writeEncoded(path, b)
+	})
+	return b, err
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
+
+// Open loads the key of envDir: derived from ENVY_PASSPHRASE when it is
+// set, otherwise read from the key file. It returns ErrNoKey when neither
+// exists.
+func Open(envDir string) (*Vault, error) {
+	return open(envDir, false)
+}
+
+// OpenOrCreate is like Open but creates a random key file (or, in
+// passphrase mode, a salt) when none exists yet.
+func OpenOrCreate(envDir string) (*Vault, error) {
+	return open(envDir, true)
+}
+
+func open(envDir string, create bool) (*Vault, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		saltPath := filepath.Join(envDir, SaltFile)
+		salt, err := readEncoded(saltPath)
+		if os.IsNotExist(err) {
+			if !create {
+				return nil, ErrNoKey
+			}
+			salt, err = createEncoded(envDir, saltPath, 16)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", SaltFile, err)
+		}
+		return fromPassphrase(passphrase, salt)
+	}
+
+	keyPath := filepath.Join(envDir, KeyFile)
+	key, err := readEncoded(keyPath)
+	if os.IsNotExist(err) {
+		if !create {
+			return nil, ErrNoKey
+		}
+		key, err = createEncoded(envDir, keyPath, keySize)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", KeyFile, err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("%s: expected a %d byte key", KeyFile, keySize)
+	}
+	return newVault(key), nil
+}
+
+// Next creates the key to rotate to: one derived from ENVY_NEW_PASSPHRASE
+// with a fresh salt when that is set, otherwise a random key. Passphrase
+// mode cannot rotate to a random key.
+func Next() (*Vault, error) {
+	salt, err := randomBytes(16)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase := os.Getenv(NewPassphraseEnv); passphrase != "" {
+		return fromPassphrase(passphrase, salt)
+	}
+	if os.Getenv(PassphraseEnv) != "" {
+		return nil, errors.New("set " + NewPassphraseEnv + " to the passphrase to rotate to")
+	}
+	key, err := randomBytes(keySize)
+	if err != nil {
+		return nil, err
+	}
+	return newVault(key), nil
+}
+
+func (v *Vault) file() string {
+	if v.salt != nil {
+		return SaltFile
+	}
+	return KeyFile
+}
+
+// Stage writes the key (or salt) next to the current one so a rotation
+// interrupted half way can be finished by hand.
+func (v *Vault) Stage(envDir string) error {
+	data := v.key
+	if v.salt != nil {
+		data = v.salt
+	}
+	return writeEncoded(filepath.Join(envDir, v.file()+".new"), data)
+}
+
+// Commit replaces the stored key (or salt) with the staged one
+func (v *Vault) Commit(envDir string) error {
+	path := filepath.Join(envDir, v.file())
+	return os.Rename(path+".new", path)
+}
+
+func (v *Vault) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(v.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals plain with AES-256-GCM and returns the value to store
+func (v *Vault) Encrypt(plain string) (string, error) {
+	gcm, err := v.aead()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomBytes(gcm.NonceSize())
+	if err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), []byte(v.id))
+	return Prefix + v.id + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt
+func (v *Vault) Decrypt(value string) (string, error) {
+	id, data, ok := strings.Cut(strings.TrimPrefix(value, Prefix), ":")
+	if !ok || !IsEncrypted(value) {
+		return "", ErrCorrupt
+	}
+	if id != v.id {
+		return "", ErrWrongKey
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	gcm, err := v.aead()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", ErrCorrupt
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(v.id))
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,115 @@
+package vault
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	t.Setenv(PassphraseEnv, "")
+	v, err := OpenOrCreate(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plain := range []string{"", "hunter2", "multi\nline ✓"} {
+		enc, err := v.Encrypt(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncrypted(enc) || strings.Contains(enc, "hunter2") {
+			t.Errorf("Encrypt(%q) = %q", plain, enc)
+		}
+		if got, err := v.Decrypt(enc); err != nil || got != plain {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q, %v", plain, got, err)
+		}
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(PassphraseEnv, "correct horse")
+	v, err := OpenOrCreate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := v.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(PassphraseEnv, "battery staple")
+	other, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Decrypt(enc); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Decrypt with the wrong passphrase = %v, want ErrWrongKey", err)
+	}
+
+	t.Setenv(PassphraseEnv, "correct horse")
+	again, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := again.Decrypt(enc); err != nil || got != "secret" {
+		t.Errorf("Decrypt with the passphrase again = %q, %v", got, err)
+	}
+}
+
+func TestOpenWithoutKey(t *testing.T) {
+	t.Setenv(PassphraseEnv, "")
+	if _, err := Open(t.TempDir()); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Open() = %v, want ErrNoKey", err)
+	}
+	t.Setenv(PassphraseEnv, "p")
+	if _, err := Open(t.TempDir()); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Open() without a salt = %v, want ErrNoKey", err)
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	t.Setenv(PassphraseEnv, "")
+	v, err := OpenOrCreate(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := v.Encrypt("secret value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, data, _ := strings.Cut(strings.TrimPrefix(enc, Prefix), ":")
+
+	// flip changes the character at i of the base64 data to another valid one
+	flip := func(i int) string {
+		b := []byte(data)
+		if b[i] == 'A' {
+			b[i] = 'B'
+		} else {
+			b[i] = 'A'
+		}
+		return Prefix + id + ":" + string(b)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  error
+	}{
+		{"nonce", flip(0), ErrCorrupt},
+		{"ciphertext", flip(len(data) / 2), ErrCorrupt},
+		{"tag", flip(len(data) - 2), ErrCorrupt},
+		{"truncated", Prefix + id + ":" + data[:8], ErrCorrupt},
+		{"not base64", Prefix + id + ":!!!", ErrCorrupt},
+		{"no key id", Prefix + data, ErrCorrupt},
+		{"no prefix", "secret value", ErrCorrupt},
+		{"other key id", Prefix + "00000000:" + data, ErrWrongKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := v.Decrypt(tt.value); !errors.Is(err, tt.want) {
+				t.Errorf("Decrypt(%q) = %q, %v; want %v", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}